@@ -1,9 +1,10 @@
 package gateway
 
 import (
-	"fmt"
-	"io/ioutil"
+	"encoding/json"
+	"math"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,11 +35,16 @@ const (
 	DefaultTimeoutInSeconds = 3
 
 	DefaultMaxFail = 3
+	// DefaultWeight . 默认权重
+	DefaultWeight = 1
+
+	// 响应时间平滑系数
+	ewmaAlpha = 0.3
 )
 
 type (
 	Backend struct {
-		// 访问协议 http|https
+		// 访问协议 http|https|thrift
 		Schema string `json:"schema"`
 		// 访问地址
 		Addr string `json:"addr"`
@@ -50,24 +56,51 @@ type (
 		HeartResponseBody string `json:"heartResponseBody"`
 		// 心跳时间
 		HeartDuration int64 `json:"heartDuration"`
+		// 健康检查配置
+		HealthCheck HealthCheck `json:"healthCheck"`
 		// 请求超时
 		Timeout int64 `json:"Timeout"`
-		// 最后检测时间
+		// 最后检测时间 由 Health 输出
 		LastHeartTime int64 `json:"lastHeartTime"`
-		// 服务状态
+		// 服务状态 由 Health 输出
 		Status BackendStatus `json:"status"`
 		// 最大qps
 		MaxQPS uint64 `json:"maxQPS"`
+		// 权重 用于加权轮询
+		Weight int64 `json:"weight"`
+		// 熔断配置
+		Breaker BreakerSetting `json:"breaker"`
+		// 连接配置
+		Transport TransportSetting `json:"transport"`
+		// TLS 配置 Schema 为 https 时生效
+		TLS TLSSetting `json:"tls"`
+		// 熔断状态
+		Circuit *CircuitBreaker `json:"circuit,omitempty"`
+		// 异常摘除状态
+		Outlier *OutlierState `json:"outlier,omitempty"`
+		// 健康检查状态与最近的检查记录
+		Health *HealthState `json:"health,omitempty"`
 
+		// 最近统计窗口内的QPS 平均/最大响应时间(毫秒)
 		QPS         uint64 `json:"QPS"`
 		MaxTime     uint64 `json:"maxTime"`
 		AverageTime uint64 `json:"averageTime"`
 		// Wait
 		Waiting uint64 `json:"waiting"`
+		// 正在转发的 WebSocket 连接数
+		Connections int64 `json:"connections"`
 
 		// private
-		httpClient     *http.Client
-		heartFailCount uint64
+		transport  http.RoundTripper
+		httpClient *http.Client
+		// thrift 后端服务的连接池
+		thrift     *thriftPool
+		healthRule *healthRule
+		// 关闭后停止健康检查
+		stop chan struct{}
+		// 响应时间的指数加权移动平均(毫秒), 按 float64 位存储
+		latencyBits uint64
+		window      *slidingWindow
 	}
 	BackendGroup []*Backend
 )
@@ -80,86 +113,183 @@ func (backend *Backend) getDefaultSetting() *Backend {
 	if backend.HeartDuration < 1 {
 		backend.HeartDuration = DefaultHeartDurationInSeconds
 	}
-	if backend.HeartDisabled {
-		backend.Status = BackendUp
+	if backend.Weight < 1 {
+		backend.Weight = DefaultWeight
+	}
+	if backend.Breaker.Enabled {
+		backend.Circuit = NewCircuitBreaker(backend.Breaker)
 	} else {
-		backend.Status = BackendDown
+		backend.Circuit = nil
+	}
+	backend.Transport = backend.Transport.getDefaultSetting()
+	// 配置错误时使用默认的 TLS 配置, 添加时已经校验
+	tlsConfig, _ := backend.TLS.Config()
+	backend.transport = backend.Transport.transport(backend.Schema, tlsConfig)
+	backend.httpClient = &http.Client{Transport: backend.transport}
+	backend.Outlier = &OutlierState{windowStart: time.Now()}
+	backend.window = newSlidingWindow(DefaultMetricsWindowInSeconds)
+	backend.HealthCheck = backend.HealthCheck.getDefaultSetting()
+	if backend.Schema == "thrift" {
+		// thrift 后端服务只能检查端口
+		backend.HealthCheck.Type = HealthCheckTCP
+		backend.thrift = newThriftPool(backend.Addr, backend.Transport)
+	}
+	// 配置错误时使用默认的检查规则, 添加时已经校验
+	if backend.healthRule, _ = backend.HealthCheck.rule(); backend.healthRule == nil {
+		backend.healthRule, _ = HealthCheck{}.rule()
+	}
+	backend.stop = make(chan struct{})
+	backend.Health = &HealthState{status: BackendDown}
+	if backend.HeartDisabled {
+		backend.Health.status = BackendUp
 	}
 	return backend
 }
 
-func (backend *Backend) heartbeat() {
-	ticker := time.NewTicker(time.Second * time.Duration(backend.HeartDuration))
-	uri := fmt.Sprintf("%s://%s%s", backend.Schema, backend.Addr, backend.HeartPath)
-	go func(uri string) {
-		for {
-			select {
-			// 终止心跳监测
-			case addr := <-heartStop:
-				if addr == backend.Addr {
-					return
-				}
-			case <-ticker.C:
-				backend.LastHeartTime = time.Now().Unix()
-				res, err := http.Get(uri)
-				if err != nil {
-					backend.heartFailCount++
-					if backend.heartFailCount == DefaultMaxFail {
-						// 移出上线队列
-						if backend.Status == BackendUp {
-							backend.Status = BackendDown
-						}
-					}
-					continue
-				}
-				if backend.HeartResponseBody == "" {
-					// 校验为空 校验状态
-					if res.StatusCode != http.StatusOK {
-						backend.heartFailCount++
-						if backend.heartFailCount == DefaultMaxFail {
-							// 移出上线队列
-							if backend.Status == BackendUp {
-								backend.Status = BackendDown
-							}
-						}
-					} else {
-						backend.heartFailCount = 0
-						if backend.Status == BackendDown {
-							backend.Status = BackendUp
-						}
-					}
-				} else {
-					defer res.Body.Close()
-					resBody, _ := ioutil.ReadAll(res.Body)
-					// 校验为空 校验状态
-					if string(resBody) != backend.HeartResponseBody {
-						backend.heartFailCount++
-						if backend.heartFailCount == DefaultMaxFail {
-							// 移出上线队列
-							if backend.Status == BackendUp {
-								backend.Status = BackendDown
-							}
-						}
-					} else {
-						backend.heartFailCount = 0
-						if backend.Status == BackendDown {
-							backend.Status = BackendUp
-						}
-					}
-				}
-			}
+// Validate . 校验 TLS 与健康检查配置
+func (backend *Backend) Validate() error {
+	if _, err := backend.TLS.Config(); err != nil {
+		return err
+	}
+	_, err := backend.HealthCheck.rule()
+	return err
+}
+
+// status . 服务状态 未设置默认值时使用 Status
+func (backend *Backend) status() BackendStatus {
+	if backend.Health == nil {
+		return backend.Status
+	}
+	status, _ := backend.Health.snapshot()
+	return status
+}
+
+// available . 是否可以参与负载均衡 熔断状态在选中后由 allow 检查
+func (backend *Backend) available() bool {
+	if backend.status() != BackendUp {
+		return false
+	}
+	return backend.Outlier == nil || !backend.Outlier.ejected(time.Now())
+}
+
+// take . 占用一个QPS名额, 超过 MaxQPS 时返回 false
+func (backend *Backend) take() bool {
+	if backend.MaxQPS < 1 || backend.window == nil {
+		return true
+	}
+	return backend.window.take(time.Now(), backend.MaxQPS)
+}
+
+// allow . 被负载均衡选中, 熔断器是否放行 半开状态下占用一个探测名额
+func (backend *Backend) allow() bool {
+	return backend.Circuit == nil || backend.Circuit.allow()
+}
+
+// abandon . 请求被客户端取消或超过路由的超时时间, 不计入后端服务的统计
+func (backend *Backend) abandon() {
+	if backend.Circuit != nil {
+		backend.Circuit.release()
+	}
+}
+
+// observe . 记录一次请求的结果
+func (backend *Backend) observe(elapsed time.Duration, failed bool) {
+	if backend.Circuit != nil {
+		backend.Circuit.record(elapsed, failed)
+	}
+	if backend.window != nil {
+		backend.window.record(time.Now(), elapsed)
+	}
+	ms := float64(elapsed) / float64(time.Millisecond)
+	for {
+		old := atomic.LoadUint64(&backend.latencyBits)
+		val := ms
+		if old != 0 {
+			val = math.Float64frombits(old)*(1-ewmaAlpha) + ms*ewmaAlpha
+		}
+		if atomic.CompareAndSwapUint64(&backend.latencyBits, old, math.Float64bits(val)) {
+			return
 		}
-	}(uri)
+	}
 }
 
-func (backendGroup BackendGroup) Len() int {
-	return len(backendGroup)
+// latency . 平均响应时间(毫秒)
+func (backend *Backend) latency() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&backend.latencyBits))
+}
+
+// load . 当前负载 等待数/最大qps
+func (backend *Backend) load() float64 {
+	maxQPS := backend.MaxQPS
+	if maxQPS < 1 {
+		maxQPS = 1
+	}
+	return float64(atomic.LoadUint64(&backend.Waiting)) / float64(maxQPS)
+}
+
+func (backend *Backend) weight() int64 {
+	if backend.Weight < 1 {
+		return DefaultWeight
+	}
+	return backend.Weight
 }
 
-func (backendGroup BackendGroup) Less(i, j int) bool {
-	return backendGroup[i].Waiting/backendGroup[i].MaxQPS-(0-uint64(backendGroup[i].Status)) < backendGroup[j].Waiting/backendGroup[j].MaxQPS-(0-uint64(backendGroup[j].Status))
+// backendTLSJSON . 返回给管理接口的 TLS 配置 不包含私钥, 只标记是否已配置
+type backendTLSJSON struct {
+	TLSSetting
+	Key    string `json:"key"`
+	HasKey bool   `json:"hasKey"`
 }
 
-func (backendGroup BackendGroup) Swap(i, j int) {
-	backendGroup[i], backendGroup[j] = backendGroup[j], backendGroup[i]
+// MarshalJSON . QPS 与响应时间取滑动窗口内的统计值
+// 请求过程中原子更新的字段逐个读取, 不能整体复制
+func (backend *Backend) MarshalJSON() ([]byte, error) {
+	type backendJSON Backend
+	snapshot := backendJSON{
+		Schema:            backend.Schema,
+		Addr:              backend.Addr,
+		HeartDisabled:     backend.HeartDisabled,
+		HeartPath:         backend.HeartPath,
+		HeartResponseBody: backend.HeartResponseBody,
+		HeartDuration:     backend.HeartDuration,
+		HealthCheck:       backend.HealthCheck,
+		Timeout:           backend.Timeout,
+		LastHeartTime:     backend.LastHeartTime,
+		Status:            backend.Status,
+		MaxQPS:            backend.MaxQPS,
+		Weight:            backend.Weight,
+		Breaker:           backend.Breaker,
+		Transport:         backend.Transport,
+		Circuit:           backend.Circuit,
+		Outlier:           backend.Outlier,
+		Health:            backend.Health,
+		Waiting:           atomic.LoadUint64(&backend.Waiting),
+		Connections:       atomic.LoadInt64(&backend.Connections),
+	}
+	if backend.Health != nil {
+		snapshot.Status, snapshot.LastHeartTime = backend.Health.snapshot()
+	}
+	if backend.window != nil {
+		stats := backend.window.stats(time.Now())
+		snapshot.QPS = stats.QPS
+		snapshot.AverageTime = stats.AverageTime
+		snapshot.MaxTime = stats.MaxTime
+	}
+	return json.Marshal(struct {
+		backendJSON
+		TLS backendTLSJSON `json:"tls"`
+	}{snapshot, backendTLSJSON{TLSSetting: backend.TLS, HasKey: backend.TLS.Key != ""}})
+}
+
+func (backendGroup BackendGroup) indexOf(addr string) int {
+	for i, l := 0, len(backendGroup); i < l; i++ {
+		if backendGroup[i].Addr == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+func (backendGroup BackendGroup) Len() int {
+	return len(backendGroup)
 }
@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// BalanceRoundRobin . 轮询
+	BalanceRoundRobin = "round-robin"
+	// BalanceWeightedRoundRobin . 加权轮询
+	BalanceWeightedRoundRobin = "weighted-round-robin"
+	// BalanceLeastConn . 最少连接 (按 Waiting/MaxQPS 计算负载)
+	BalanceLeastConn = "least-conn"
+	// BalanceRandomTwoChoices . 随机选择两个后取负载较低的
+	BalanceRandomTwoChoices = "random-two-choices"
+	// BalanceEWMA . 按响应时间的指数加权移动平均选择
+	BalanceEWMA = "ewma"
+
+	// DefaultLoadBalance . 默认策略
+	DefaultLoadBalance = BalanceLeastConn
+)
+
+type (
+	// Balancer . 负载均衡策略
+	Balancer interface {
+		Name() string
+		// Pick . 从上线的后端服务中选择一个, backends 不为空
+		Pick(backends BackendGroup, ctx *Context) (*Backend, error)
+	}
+	// BalancerFactory . 创建负载均衡策略
+	BalancerFactory func(cluster *Cluster) Balancer
+
+	roundRobin struct {
+		counter uint64
+	}
+	weightedRoundRobin struct {
+		mtx     sync.Mutex
+		current map[string]int64
+	}
+	leastConn        struct{}
+	randomTwoChoices struct{}
+	ewmaBalancer     struct{}
+)
+
+var balancers = map[string]BalancerFactory{
+	BalanceRoundRobin: func(cluster *Cluster) Balancer {
+		return &roundRobin{}
+	},
+	BalanceWeightedRoundRobin: func(cluster *Cluster) Balancer {
+		return &weightedRoundRobin{current: make(map[string]int64)}
+	},
+	BalanceLeastConn: func(cluster *Cluster) Balancer {
+		return leastConn{}
+	},
+	BalanceRandomTwoChoices: func(cluster *Cluster) Balancer {
+		return randomTwoChoices{}
+	},
+	BalanceEWMA: func(cluster *Cluster) Balancer {
+		return ewmaBalancer{}
+	},
+}
+
+// RegisterBalancer . 注册负载均衡策略, 需在添加集群前调用
+func RegisterBalancer(name string, factory BalancerFactory) {
+	balancers[name] = factory
+}
+
+// NewBalancer . 按名称创建负载均衡策略, 名称为空时使用默认策略
+func NewBalancer(name string, cluster *Cluster) (Balancer, error) {
+	if name == "" {
+		name = DefaultLoadBalance
+	}
+	factory, ok := balancers[name]
+	if !ok {
+		return nil, BalancerUnknowable
+	}
+	return factory(cluster), nil
+}
+
+func (balancer *roundRobin) Name() string {
+	return BalanceRoundRobin
+}
+
+func (balancer *roundRobin) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	index := atomic.AddUint64(&balancer.counter, 1) - 1
+	return backends[index%uint64(len(backends))], nil
+}
+
+func (balancer *weightedRoundRobin) Name() string {
+	return BalanceWeightedRoundRobin
+}
+
+// Pick . 平滑加权轮询
+func (balancer *weightedRoundRobin) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	balancer.mtx.Lock()
+	defer balancer.mtx.Unlock()
+	var (
+		best  *Backend
+		total int64
+	)
+	for i, l := 0, len(backends); i < l; i++ {
+		weight := backends[i].weight()
+		total += weight
+		balancer.current[backends[i].Addr] += weight
+		if best == nil || balancer.current[backends[i].Addr] > balancer.current[best.Addr] {
+			best = backends[i]
+		}
+	}
+	balancer.current[best.Addr] -= total
+	// 清理已下线的后端服务
+	if len(balancer.current) > len(backends) {
+		for addr := range balancer.current {
+			if backends.indexOf(addr) == -1 {
+				delete(balancer.current, addr)
+			}
+		}
+	}
+	return best, nil
+}
+
+func (balancer leastConn) Name() string {
+	return BalanceLeastConn
+}
+
+func (balancer leastConn) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	best := backends[0]
+	for i, l := 1, len(backends); i < l; i++ {
+		if backends[i].load() < best.load() {
+			best = backends[i]
+		}
+	}
+	return best, nil
+}
+
+func (balancer randomTwoChoices) Name() string {
+	return BalanceRandomTwoChoices
+}
+
+func (balancer randomTwoChoices) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	l := len(backends)
+	if l == 1 {
+		return backends[0], nil
+	}
+	i := rand.Intn(l)
+	j := rand.Intn(l - 1)
+	if j >= i {
+		j++
+	}
+	if backends[j].load() < backends[i].load() {
+		return backends[j], nil
+	}
+	return backends[i], nil
+}
+
+func (balancer ewmaBalancer) Name() string {
+	return BalanceEWMA
+}
+
+// Pick . 按 平均响应时间*(等待数+1) 选择, 未有请求的后端服务优先
+func (balancer ewmaBalancer) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	var (
+		best *Backend
+		min  = math.MaxFloat64
+	)
+	for i, l := 0, len(backends); i < l; i++ {
+		cost := backends[i].latency() * float64(atomic.LoadUint64(&backends[i].Waiting)+1)
+		if cost < min {
+			best, min = backends[i], cost
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// BalanceConsistentHash . 一致性哈希
+	BalanceConsistentHash = "consistent-hash"
+
+	// HashOnHeader . 按请求头哈希
+	HashOnHeader = "header"
+	// HashOnQuery . 按查询参数哈希
+	HashOnQuery = "query"
+	// HashOnCookie . 按 Cookie 哈希
+	HashOnCookie = "cookie"
+	// HashOnUserID . 按用户ID哈希 (auth 插件解析的 userId)
+	HashOnUserID = "userId"
+	// HashOnIP . 按客户端IP哈希
+	HashOnIP = "ip"
+
+	// 每个权重对应的虚拟节点数
+	hashReplicas = 160
+)
+
+type (
+	// BackendsWatcher . 需要感知后端服务增减的负载均衡策略
+	BackendsWatcher interface {
+		Update(backends BackendGroup)
+	}
+
+	consistentHash struct {
+		hashOn  string
+		hashKey string
+
+		mtx    sync.RWMutex
+		hashes []uint32
+		ring   map[uint32]string
+	}
+)
+
+func init() {
+	RegisterBalancer(BalanceConsistentHash, func(cluster *Cluster) Balancer {
+		return &consistentHash{
+			hashOn:  cluster.HashOn,
+			hashKey: cluster.HashKey,
+			ring:    make(map[uint32]string),
+		}
+	})
+}
+
+// 校验哈希配置
+func validHashOn(hashOn, hashKey string) error {
+	switch hashOn {
+	case HashOnHeader, HashOnQuery, HashOnCookie:
+		if hashKey == "" {
+			return HashKeyNotValid
+		}
+	case "", HashOnUserID, HashOnIP:
+	default:
+		return HashKeyNotValid
+	}
+	return nil
+}
+
+func (balancer *consistentHash) Name() string {
+	return BalanceConsistentHash
+}
+
+// Update . 重建哈希环, 虚拟节点位置只与地址有关, 增减后端服务只影响相邻区间
+func (balancer *consistentHash) Update(backends BackendGroup) {
+	hashes := make([]uint32, 0, len(backends)*hashReplicas)
+	ring := make(map[uint32]string, len(backends)*hashReplicas)
+	for i, l := 0, len(backends); i < l; i++ {
+		replicas := int(backends[i].weight()) * hashReplicas
+		for j := 0; j < replicas; j++ {
+			hash := crc32.ChecksumIEEE([]byte(backends[i].Addr + "#" + strconv.Itoa(j)))
+			if _, ok := ring[hash]; ok {
+				continue
+			}
+			ring[hash] = backends[i].Addr
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	balancer.mtx.Lock()
+	balancer.hashes = hashes
+	balancer.ring = ring
+	balancer.mtx.Unlock()
+}
+
+// Pick . 顺时针查找第一个上线的后端服务, 无法获取哈希值时随机选择
+func (balancer *consistentHash) Pick(backends BackendGroup, ctx *Context) (*Backend, error) {
+	key := balancer.key(ctx)
+	if key == "" {
+		return backends[rand.Intn(len(backends))], nil
+	}
+	available := make(map[string]*Backend, len(backends))
+	for i, l := 0, len(backends); i < l; i++ {
+		available[backends[i].Addr] = backends[i]
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	balancer.mtx.RLock()
+	defer balancer.mtx.RUnlock()
+	l := len(balancer.hashes)
+	start := sort.Search(l, func(i int) bool { return balancer.hashes[i] >= hash })
+	for i := 0; i < l; i++ {
+		addr := balancer.ring[balancer.hashes[(start+i)%l]]
+		if backend, ok := available[addr]; ok {
+			return backend, nil
+		}
+	}
+	// 哈希环尚未包含的后端服务
+	return backends[hash%uint32(len(backends))], nil
+}
+
+// 获取哈希值
+func (balancer *consistentHash) key(ctx *Context) string {
+	if ctx == nil || ctx.Request == nil {
+		return ""
+	}
+	switch balancer.hashOn {
+	case HashOnHeader:
+		return ctx.Request.Header.Get(balancer.hashKey)
+	case HashOnQuery:
+		return ctx.Query(balancer.hashKey)
+	case HashOnCookie:
+		val, _ := ctx.Cookie(balancer.hashKey)
+		return val
+	case HashOnUserID:
+		if val, ok := ctx.Get("userId"); ok {
+			if userID, ok := val.(string); ok && userID != "" {
+				return userID
+			}
+		}
+		if userID := ctx.Query("userId"); userID != "" {
+			return userID
+		}
+		return ctx.Request.Header.Get("userId")
+	}
+	return ctx.ClientIP()
+}
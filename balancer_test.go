@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestWeightedRoundRobin(t *testing.T) {
+	backends := BackendGroup{
+		{Addr: "a", Weight: 5},
+		{Addr: "b", Weight: 1},
+		{Addr: "c", Weight: 1},
+	}
+	balancer, _ := NewBalancer(BalanceWeightedRoundRobin, nil)
+	count := make(map[string]int)
+	for i := 0; i < 70; i++ {
+		backend, _ := balancer.Pick(backends, nil)
+		count[backend.Addr]++
+	}
+	if count["a"] != 50 || count["b"] != 10 || count["c"] != 10 {
+		t.Fatalf("unexpected distribution %v", count)
+	}
+}
+
+func TestCluster_Balance(t *testing.T) {
+	cluster := &Cluster{Name: "test", LoadBalance: BalanceRoundRobin}
+	if err := cluster.SetLoadBalance(cluster.LoadBalance); err != nil {
+		t.Fatal(err)
+	}
+	cluster.backends = BackendGroup{
+		{Addr: "a", Status: BackendUp},
+		{Addr: "b", Status: BackendDown},
+		{Addr: "c", Status: BackendUp},
+	}
+	for i := 0; i < 10; i++ {
+		backend, err := cluster.Balance(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backend.Addr == "b" {
+			t.Fatal("down backend should not be picked")
+		}
+	}
+	if err := cluster.SetLoadBalance("unknown"); err != BalancerUnknowable {
+		t.Fatalf("want BalancerUnknowable, got %v", err)
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	backends := BackendGroup{
+		{Addr: "a", MaxQPS: 10, Waiting: 5},
+		{Addr: "b", MaxQPS: 100, Waiting: 20},
+	}
+	balancer, _ := NewBalancer(BalanceLeastConn, nil)
+	if backend, _ := balancer.Pick(backends, nil); backend.Addr != "b" {
+		t.Fatalf("want b, got %s", backend.Addr)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	cluster := &Cluster{Name: "test", LoadBalance: BalanceConsistentHash, HashOn: HashOnHeader, HashKey: "X-User"}
+	if err := cluster.SetLoadBalance(cluster.LoadBalance); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"a", "b", "c", "d"} {
+		cluster.backends = append(cluster.backends, &Backend{Addr: addr, Status: BackendUp})
+	}
+	cluster.watch()
+	pick := func(user string) string {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User", user)
+		backend, err := cluster.Balance(&Context{Request: req})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backend.Addr
+	}
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		user := strconv.Itoa(i)
+		before[user] = pick(user)
+		if pick(user) != before[user] {
+			t.Fatal("same key should be routed to the same backend")
+		}
+	}
+	// 下线的后端服务被跳过, 其余 key 不受影响
+	cluster.backends[1].Status = BackendDown
+	for user, addr := range before {
+		now := pick(user)
+		if now == "b" || (addr != "b" && now != addr) {
+			t.Fatalf("user %s moved from %s to %s", user, addr, now)
+		}
+	}
+	cluster.backends[1].Status = BackendUp
+	// 移除一个后端服务, 只有它的 key 会迁移
+	cluster.backends = append(cluster.backends[:2], cluster.backends[3:]...)
+	cluster.watch()
+	for user, addr := range before {
+		if now := pick(user); addr != "c" && now != addr {
+			t.Fatalf("user %s moved from %s to %s", user, addr, now)
+		}
+	}
+	if err := cluster.configure(&Cluster{LoadBalance: BalanceConsistentHash, HashOn: HashOnHeader}); err != HashKeyNotValid {
+		t.Fatalf("want HashKeyNotValid, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package gateway
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CircuitState . 熔断状态
+type CircuitState int
+
+const (
+	// CircuitClosed . 关闭 正常放行
+	CircuitClosed CircuitState = iota
+	// CircuitOpen . 打开 拒绝请求
+	CircuitOpen
+	// CircuitHalfOpen . 半开 放行少量探测请求
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	// DefaultBreakerFailures . 默认连续失败次数
+	DefaultBreakerFailures = 5
+	// DefaultBreakerErrorRate . 默认错误率
+	DefaultBreakerErrorRate = 0.5
+	// DefaultBreakerMinRequests . 默认统计错误率的最小请求数
+	DefaultBreakerMinRequests = 20
+	// DefaultBreakerWindowInSeconds . 默认统计窗口
+	DefaultBreakerWindowInSeconds = 10
+	// DefaultBreakerOpenInSeconds . 默认熔断时间
+	DefaultBreakerOpenInSeconds = 30
+	// DefaultBreakerHalfOpenRequests . 默认半开探测请求数
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+type (
+	// BreakerSetting . 熔断配置
+	BreakerSetting struct {
+		// 是否开启熔断
+		Enabled bool `json:"enabled"`
+		// 连续失败次数
+		ConsecutiveFailures uint64 `json:"consecutiveFailures"`
+		// 错误率 0-1
+		ErrorRate float64 `json:"errorRate"`
+		// 统计错误率的最小请求数
+		MinRequests uint64 `json:"minRequests"`
+		// 慢请求阈值(毫秒) 超过视为失败, 0 为不限制
+		SlowThreshold int64 `json:"slowThreshold"`
+		// 统计窗口(秒)
+		Window int64 `json:"window"`
+		// 熔断时间(秒)
+		OpenDuration int64 `json:"openDuration"`
+		// 半开状态允许的探测请求数
+		HalfOpenRequests uint64 `json:"halfOpenRequests"`
+	}
+	// CircuitBreaker . 熔断器 由实际请求结果驱动
+	CircuitBreaker struct {
+		setting BreakerSetting
+
+		mtx         sync.Mutex
+		state       CircuitState
+		failures    uint64
+		requests    uint64
+		errors      uint64
+		windowStart time.Time
+		openedAt    time.Time
+		probing     uint64
+		probed      uint64
+	}
+)
+
+// 设置默认值
+func (setting BreakerSetting) getDefaultSetting() BreakerSetting {
+	if setting.ConsecutiveFailures < 1 {
+		setting.ConsecutiveFailures = DefaultBreakerFailures
+	}
+	if setting.ErrorRate <= 0 || setting.ErrorRate > 1 {
+		setting.ErrorRate = DefaultBreakerErrorRate
+	}
+	if setting.MinRequests < 1 {
+		setting.MinRequests = DefaultBreakerMinRequests
+	}
+	if setting.Window < 1 {
+		setting.Window = DefaultBreakerWindowInSeconds
+	}
+	if setting.OpenDuration < 1 {
+		setting.OpenDuration = DefaultBreakerOpenInSeconds
+	}
+	if setting.HalfOpenRequests < 1 {
+		setting.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+	return setting
+}
+
+// NewCircuitBreaker .
+func NewCircuitBreaker(setting BreakerSetting) *CircuitBreaker {
+	return &CircuitBreaker{
+		setting:     setting.getDefaultSetting(),
+		windowStart: time.Now(),
+	}
+}
+
+// State . 当前状态
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	return breaker.state
+}
+
+// allow . 被负载均衡选中后是否可以接收请求
+// 熔断时间结束后进入半开状态, 半开状态下检查并占用一个探测名额
+func (breaker *CircuitBreaker) allow() bool {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	switch breaker.state {
+	case CircuitOpen:
+		if time.Since(breaker.openedAt) < time.Duration(breaker.setting.OpenDuration)*time.Second {
+			return false
+		}
+		breaker.state = CircuitHalfOpen
+		breaker.probing = 0
+		breaker.probed = 0
+	case CircuitClosed:
+		return true
+	}
+	if breaker.probing >= breaker.setting.HalfOpenRequests {
+		return false
+	}
+	breaker.probing++
+	return true
+}
+
+// release . 请求被取消, 归还探测名额 不计入统计
+func (breaker *CircuitBreaker) release() {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	if breaker.state == CircuitHalfOpen && breaker.probing > 0 {
+		breaker.probing--
+	}
+}
+
+// record . 记录请求结果
+func (breaker *CircuitBreaker) record(elapsed time.Duration, failed bool) {
+	if breaker.setting.SlowThreshold > 0 && elapsed > time.Duration(breaker.setting.SlowThreshold)*time.Millisecond {
+		failed = true
+	}
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	now := time.Now()
+	switch breaker.state {
+	case CircuitHalfOpen:
+		if breaker.probing > 0 {
+			breaker.probing--
+		}
+		if failed {
+			breaker.trip(now)
+			return
+		}
+		breaker.probed++
+		if breaker.probed >= breaker.setting.HalfOpenRequests {
+			breaker.reset(now)
+		}
+	case CircuitClosed:
+		if now.Sub(breaker.windowStart) > time.Duration(breaker.setting.Window)*time.Second {
+			breaker.windowStart = now
+			breaker.requests = 0
+			breaker.errors = 0
+		}
+		breaker.requests++
+		if !failed {
+			breaker.failures = 0
+			return
+		}
+		breaker.failures++
+		breaker.errors++
+		if breaker.failures >= breaker.setting.ConsecutiveFailures ||
+			(breaker.requests >= breaker.setting.MinRequests &&
+				float64(breaker.errors)/float64(breaker.requests) >= breaker.setting.ErrorRate) {
+			breaker.trip(now)
+		}
+	}
+}
+
+func (breaker *CircuitBreaker) trip(now time.Time) {
+	breaker.state = CircuitOpen
+	breaker.openedAt = now
+	breaker.probing = 0
+	breaker.probed = 0
+}
+
+func (breaker *CircuitBreaker) reset(now time.Time) {
+	breaker.state = CircuitClosed
+	breaker.failures = 0
+	breaker.requests = 0
+	breaker.errors = 0
+	breaker.windowStart = now
+}
+
+// MarshalJSON . 输出当前状态
+func (breaker *CircuitBreaker) MarshalJSON() ([]byte, error) {
+	breaker.mtx.Lock()
+	defer breaker.mtx.Unlock()
+	var openedAt int64
+	if !breaker.openedAt.IsZero() {
+		openedAt = breaker.openedAt.Unix()
+	}
+	return json.Marshal(H{
+		"state":               breaker.state.String(),
+		"consecutiveFailures": breaker.failures,
+		"requests":            breaker.requests,
+		"errors":              breaker.errors,
+		"openedAt":            openedAt,
+	})
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSetting{
+		Enabled:             true,
+		ConsecutiveFailures: 3,
+		SlowThreshold:       100,
+		OpenDuration:        1,
+		HalfOpenRequests:    2,
+	})
+	breaker.record(time.Millisecond, true)
+	breaker.record(time.Millisecond, true)
+	breaker.record(time.Millisecond, false)
+	if breaker.State() != CircuitClosed {
+		t.Fatal("success should reset consecutive failures")
+	}
+	breaker.record(time.Millisecond, true)
+	breaker.record(time.Millisecond, true)
+	// 慢请求视为失败
+	breaker.record(200*time.Millisecond, false)
+	if breaker.State() != CircuitOpen || breaker.allow() {
+		t.Fatalf("breaker should be open, got %s", breaker.State())
+	}
+	breaker.openedAt = time.Now().Add(-2 * time.Second)
+	if !breaker.allow() || breaker.State() != CircuitHalfOpen {
+		t.Fatalf("breaker should be half-open, got %s", breaker.State())
+	}
+	if !breaker.allow() || breaker.allow() {
+		t.Fatal("half-open breaker should only allow 2 probes")
+	}
+	breaker.record(time.Millisecond, false)
+	breaker.record(time.Millisecond, true)
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("failed probe should reopen breaker, got %s", breaker.State())
+	}
+	breaker.openedAt = time.Now().Add(-2 * time.Second)
+	breaker.allow()
+	breaker.allow()
+	breaker.record(time.Millisecond, false)
+	breaker.record(time.Millisecond, false)
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("successful probes should close breaker, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreaker_ErrorRate(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSetting{
+		Enabled:             true,
+		ConsecutiveFailures: 100,
+		ErrorRate:           0.5,
+		MinRequests:         10,
+	})
+	for i := 0; i < 10; i++ {
+		breaker.record(time.Millisecond, i%2 == 1)
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("breaker should open at 50%% error rate, got %s", breaker.State())
+	}
+}
+
+// 并发请求不能超过半开状态的探测名额
+func TestCircuitBreaker_HalfOpenConcurrent(t *testing.T) {
+	breaker := NewCircuitBreaker(BreakerSetting{Enabled: true, ConsecutiveFailures: 1, HalfOpenRequests: 2})
+	breaker.record(time.Millisecond, true)
+	breaker.openedAt = time.Now().Add(-time.Hour)
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if breaker.allow() {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 2 {
+		t.Fatalf("want 2 probes, got %d", allowed)
+	}
+}
+
+// 未被选中的后端服务不会进入半开状态
+func TestCircuitBreaker_Balance(t *testing.T) {
+	cluster := &Cluster{Name: "breaker"}
+	cluster.Add(&Backend{Addr: "127.0.0.1:1", HeartDisabled: true, Breaker: BreakerSetting{Enabled: true, ConsecutiveFailures: 1, OpenDuration: 1}})
+	backend := cluster.Backends()[0]
+	backend.Circuit.record(time.Millisecond, true)
+	if _, err := cluster.Balance(nil); err != BackendServiceNotAvailable {
+		t.Fatalf("want BackendServiceNotAvailable, got %v", err)
+	}
+	backend.Circuit.mtx.Lock()
+	backend.Circuit.openedAt = time.Now().Add(-2 * time.Second)
+	backend.Circuit.mtx.Unlock()
+	if backend.Circuit.State() != CircuitOpen {
+		t.Fatalf("breaker should stay open until picked, got %s", backend.Circuit.State())
+	}
+	if picked, err := cluster.Balance(nil); err != nil || picked != backend || backend.Circuit.State() != CircuitHalfOpen {
+		t.Fatalf("picked backend should probe, got %v %s", err, backend.Circuit.State())
+	}
+}
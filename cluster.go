@@ -1,7 +1,6 @@
 package gateway
 
 import (
-	"sort"
 	"sync"
 )
 
@@ -10,8 +9,17 @@ type (
 		// 集群名称
 		Name        string `json:"name,omitempty"`
 		Description string `json:"description,omitempty"`
+		// 负载均衡策略
+		LoadBalance string `json:"loadBalance,omitempty"`
+		// 一致性哈希的取值来源 header|query|cookie|userId|ip
+		HashOn string `json:"hashOn,omitempty"`
+		// 一致性哈希的取值名称 例如请求头名称
+		HashKey string `json:"hashKey,omitempty"`
+		// 异常摘除配置
+		Outlier OutlierSetting `json:"outlier"`
 		// 后端服务
 		backends BackendGroup
+		balancer Balancer
 
 		rwMutex sync.RWMutex
 	}
@@ -21,19 +29,31 @@ type (
 	}
 )
 
-var heartStop = make(chan string)
-
 // Backends . 获取所有的后端服务
 func (cluster *Cluster) Backends() BackendGroup {
 	return cluster.backends
 }
 
+// Backend . 获取后端服务
+func (cluster *Cluster) Backend(addr string) (bool, *Backend) {
+	cluster.rwMutex.RLock()
+	defer cluster.rwMutex.RUnlock()
+	index := cluster.backends.indexOf(addr)
+	if index == -1 {
+		return false, nil
+	}
+	return true, cluster.backends[index]
+}
+
 // Add . 增加一个后端服务
 func (cluster *Cluster) Add(backend *Backend) error {
 	index := cluster.indexOf(backend.Addr)
 	if index != -1 {
 		return BackendAlreadyExist
 	}
+	if err := backend.Validate(); err != nil {
+		return err
+	}
 	cluster.addBackend(backend)
 	return nil
 }
@@ -43,9 +63,10 @@ func (cluster *Cluster) addBackend(backend *Backend) {
 	defer cluster.rwMutex.Unlock()
 	backend.getDefaultSetting()
 	if !backend.HeartDisabled {
-		backend.heartbeat()
+		backend.healthcheck()
 	}
 	cluster.backends = append(cluster.backends, backend)
+	cluster.watch()
 }
 
 // Remove . 移除后端服务
@@ -54,12 +75,11 @@ func (cluster *Cluster) Remove(addr string) error {
 	if index == -1 {
 		return BackendNotFound
 	}
-	if !cluster.backends[index].HeartDisabled {
-		heartStop <- cluster.backends[index].Addr
-	}
 	cluster.rwMutex.Lock()
 	defer cluster.rwMutex.Unlock()
+	cluster.backends[index].close()
 	cluster.backends = append(cluster.backends[:index], cluster.backends[index+1:]...)
+	cluster.watch()
 	return nil
 }
 
@@ -70,38 +90,116 @@ func (cluster *Cluster) Update(backend *Backend) {
 		cluster.addBackend(backend)
 		return
 	}
-	heartStop <- cluster.backends[index].Addr
 	cluster.rwMutex.Lock()
 	defer cluster.rwMutex.Unlock()
 	backend.getDefaultSetting()
 	if !backend.HeartDisabled {
-		backend.heartbeat()
+		backend.healthcheck()
 	}
+	cluster.backends[index].close()
 	cluster.backends[index] = backend
+	cluster.watch()
+}
+
+// SetLoadBalance . 设置负载均衡策略
+func (cluster *Cluster) SetLoadBalance(name string) error {
+	cluster.rwMutex.RLock()
+	config := &Cluster{
+		Name:        cluster.Name,
+		LoadBalance: name,
+		HashOn:      cluster.HashOn,
+		HashKey:     cluster.HashKey,
+		Outlier:     cluster.Outlier,
+	}
+	cluster.rwMutex.RUnlock()
+	return cluster.configure(config)
+}
+
+// configure . 按 config 更新负载均衡与异常摘除配置
+func (cluster *Cluster) configure(config *Cluster) error {
+	if config.LoadBalance == BalanceConsistentHash {
+		if err := validHashOn(config.HashOn, config.HashKey); err != nil {
+			return err
+		}
+	}
+	balancer, err := NewBalancer(config.LoadBalance, config)
+	if err != nil {
+		return err
+	}
+	cluster.rwMutex.Lock()
+	defer cluster.rwMutex.Unlock()
+	cluster.LoadBalance = balancer.Name()
+	cluster.HashOn = config.HashOn
+	cluster.HashKey = config.HashKey
+	cluster.Outlier = config.Outlier
+	cluster.balancer = balancer
+	cluster.watch()
+	return nil
 }
 
-// Balance . 负载均衡
-func (cluster *Cluster) Balance() (backend *Backend, err error) {
-	if cluster.backends.Len() < 1 {
+// watch . 通知负载均衡策略后端服务发生变化, 调用方需持有写锁
+func (cluster *Cluster) watch() {
+	if watcher, ok := cluster.balancer.(BackendsWatcher); ok {
+		watcher.Update(cluster.backends)
+	}
+}
+
+// Balance . 负载均衡 excludes 为需要排除的后端服务地址
+func (cluster *Cluster) Balance(ctx *Context, excludes ...string) (backend *Backend, err error) {
+	cluster.rwMutex.RLock()
+	balancer := cluster.balancer
+	available := make(BackendGroup, 0, len(cluster.backends))
+	for i, l := 0, len(cluster.backends); i < l; i++ {
+		if !excluded(excludes, cluster.backends[i].Addr) && cluster.backends[i].available() {
+			available = append(available, cluster.backends[i])
+		}
+	}
+	cluster.rwMutex.RUnlock()
+	if len(available) < 1 {
 		return nil, BackendServiceNotAvailable
 	}
-	sort.Sort(cluster.backends)
-	for i, l := 0, cluster.backends.Len(); i < l; i++ {
-		if cluster.backends[i].Status == BackendUp {
-			return cluster.backends[i], nil
+	if balancer == nil {
+		if err = cluster.SetLoadBalance(cluster.LoadBalance); err != nil {
+			return nil, err
+		}
+		balancer = cluster.balancer
+	}
+	// 熔断或超过 MaxQPS 的后端服务被排除后重新选择
+	exceeded := false
+	for len(available) > 0 {
+		if backend, err = balancer.Pick(available, ctx); err != nil {
+			return nil, err
+		}
+		if backend.allow() {
+			if backend.take() {
+				return backend, nil
+			}
+			// 归还探测名额
+			backend.abandon()
+			exceeded = true
 		}
+		index := available.indexOf(backend.Addr)
+		available = append(available[:index], available[index+1:]...)
+	}
+	if exceeded {
+		return nil, BackendQPSExceeded
 	}
 	return nil, BackendServiceNotAvailable
 }
 
-func (cluster *Cluster) indexOf(addr string) (index int) {
-	index = -1
-	for i, l := 0, len(cluster.backends); i < l; i++ {
-		if cluster.backends[i].Addr == addr {
-			return i
+func excluded(excludes []string, addr string) bool {
+	for i, l := 0, len(excludes); i < l; i++ {
+		if excludes[i] == addr {
+			return true
 		}
 	}
-	return index
+	return false
+}
+
+func (cluster *Cluster) indexOf(addr string) (index int) {
+	cluster.rwMutex.RLock()
+	defer cluster.rwMutex.RUnlock()
+	return cluster.backends.indexOf(addr)
 }
 
 // Add . 添加一个集群
@@ -110,6 +208,9 @@ func (clusterGroup *ClusterGroup) Add(cluster *Cluster) error {
 	if index != -1 {
 		return ClusterAlreadyExist
 	}
+	if err := cluster.SetLoadBalance(cluster.LoadBalance); err != nil {
+		return err
+	}
 	clusterGroup.rwMutex.Lock()
 	defer clusterGroup.rwMutex.Unlock()
 	clusterGroup.clusters = append(clusterGroup.clusters, cluster)
@@ -138,17 +239,19 @@ func (clusterGroup *ClusterGroup) Get(clusterName string) (has bool, cluster *Cl
 }
 
 // Update . 更新集群
-func (clusterGroup *ClusterGroup) Update(cluster *Cluster) {
+func (clusterGroup *ClusterGroup) Update(cluster *Cluster) error {
 	index := clusterGroup.indexOf(cluster.Name)
-	clusterGroup.rwMutex.Lock()
-	defer clusterGroup.rwMutex.Unlock()
 	if index == -1 {
-		clusterGroup.clusters = append(clusterGroup.clusters, cluster)
-		return
+		return clusterGroup.Add(cluster)
 	}
+	clusterGroup.rwMutex.Lock()
+	defer clusterGroup.rwMutex.Unlock()
 	// copy info
+	if err := clusterGroup.clusters[index].configure(cluster); err != nil {
+		return err
+	}
 	clusterGroup.clusters[index].Description = cluster.Description
-	return
+	return nil
 }
 
 // Clusters . 集群列表
@@ -1,11 +1,12 @@
 package gateway
 
 import (
-	"encoding/json"
 	"fmt"
 	"goodsogood/gateway/render"
 	"io"
+	"io/ioutil"
 	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -21,7 +22,10 @@ type (
 	ExecInfo struct {
 		BackendADDR string  `json:"addr"`
 		BackendURI  string  `json:"uri"`
+		Attempt     int     `json:"attempt"`
+		Status      int     `json:"status"`
 		Success     bool    `json:"success"`
+		Error       string  `json:"error,omitempty"`
 		ExecTime    float64 `json:"execTime"`
 	}
 	// Context .
@@ -29,15 +33,25 @@ type (
 		writermem responseWriter
 		Request   *http.Request
 		Writer    ResponseWriter
+		Params    PathParams
 		routeInfo RouteInfo
 		index     int8
 		engine    *Engine
 		responses []combineResponse
+		// 节点返回的 JSON, 供依赖的节点读取
+		outputs []interface{}
+		// JSON 格式的请求体
+		jsonBody   interface{}
+		jsonParsed bool
 
 		ExecInfoGroup []ExecInfo
 
 		handlers HandlesChain
 		Keys     map[string]interface{}
+
+		// 请求的 context, 包含路由的超时时间
+		ctx    context.Context
+		cancel context.CancelFunc
 	}
 )
 
@@ -46,11 +60,48 @@ var _ context.Context = &Context{}
 func (c *Context) reset() {
 	c.Writer = &c.writermem
 	c.index = -1
+	c.Params = nil
 	c.routeInfo = RouteInfo{}
 	c.responses = nil
+	c.outputs = nil
+	c.jsonBody = nil
+	c.jsonParsed = false
 	c.ExecInfoGroup = nil
 	c.handlers = nil
 	c.Keys = nil
+	c.ctx = nil
+	c.cancel = nil
+}
+
+// withTimeout . 包装请求的 context, timeout(毫秒) 大于 0 时设置整体超时时间
+func (c *Context) withTimeout(timeout int64) {
+	parent := context.Background()
+	if c.Request != nil {
+		parent = c.Request.Context()
+	}
+	if timeout > 0 {
+		c.ctx, c.cancel = context.WithTimeout(parent, time.Duration(timeout)*time.Millisecond)
+		return
+	}
+	c.ctx, c.cancel = context.WithCancel(parent)
+}
+
+// release . 结束请求 释放 context 的资源
+func (c *Context) release() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// context 未初始化时使用请求的 context
+func (c *Context) base() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	if c.Request != nil {
+		return c.Request.Context()
+	}
+	return context.Background()
 }
 
 // Next . 继续执行
@@ -88,6 +139,33 @@ func (c *Context) Get(key string) (value interface{}, exists bool) {
 	return
 }
 
+// nodeValue . 读取依赖节点返回值中的参数 attr 格式为 节点名.JSON路径
+func (c *Context) nodeValue(attr string) interface{} {
+	name, path := splitNodeAttr(attr)
+	graph := c.routeInfo.graph
+	if graph == nil {
+		return nil
+	}
+	index, ok := graph.index[name]
+	if !ok || index >= len(c.outputs) {
+		return nil
+	}
+	val, _ := jsonPath(c.outputs[index], path)
+	return val
+}
+
+// jsonValue . 读取 JSON 请求体中的参数
+func (c *Context) jsonValue(path string) interface{} {
+	c.parseJSON()
+	val, _ := jsonPath(c.jsonBody, path)
+	return val
+}
+
+// Param . 获取路径参数 例如 /users/:id
+func (c *Context) Param(key string) string {
+	return c.Params.ByName(key)
+}
+
 // Query .
 func (c *Context) Query(key string) string {
 	value, _ := c.GetQuery(key)
@@ -139,10 +217,32 @@ func (c *Context) PostFormArray(key string) []string {
 	return values
 }
 
+// parseForm . 解析表单 并发读取参数前需要先调用
+func (c *Context) parseForm() {
+	c.parseJSON()
+	c.Request.ParseForm()
+	if c.Request.MultipartForm == nil {
+		c.Request.ParseMultipartForm(32 << 20) // 32 MB
+	}
+}
+
+// parseJSON . Content-Type 为 application/json 时解析请求体, 只解析一次
+func (c *Context) parseJSON() {
+	if c.jsonParsed {
+		return
+	}
+	c.jsonParsed = true
+	if c.Request.Body == nil || c.ContentType() != "application/json" {
+		return
+	}
+	if body, err := ioutil.ReadAll(c.Request.Body); err == nil {
+		c.jsonBody, _ = decodeJSON(body)
+	}
+}
+
 func (c *Context) GetPostFormArray(key string) ([]string, bool) {
 	req := c.Request
-	req.ParseForm()
-	req.ParseMultipartForm(32 << 20) // 32 MB
+	c.parseForm()
 	if values := req.PostForm[key]; len(values) > 0 {
 		return values, true
 	}
@@ -164,7 +264,13 @@ func (c *Context) ClientIP() string {
 		clientIP = clientIP[0:index]
 	}
 	clientIP = strings.TrimSpace(clientIP)
-	return clientIP
+	if len(clientIP) > 0 {
+		return clientIP
+	}
+	if ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr)); err == nil {
+		return ip
+	}
+	return ""
 }
 
 func (c *Context) RouteInfo() RouteInfo {
@@ -252,8 +358,24 @@ func (c *Context) JSON(code int, obj interface{}) {
 
 type H map[string]interface{}
 
+// collect . 按顺序保存节点的执行结果
+func (c *Context) collect(responses ...combineResponse) {
+	for i, l := 0, len(responses); i < l; i++ {
+		c.responses = append(c.responses, responses[i])
+		c.ExecInfoGroup = append(c.ExecInfoGroup, responses[i].execInfoGroup...)
+	}
+}
+
 // Render .
 func (c *Context) Render(code int, obj interface{}) {
+	// gRPC 客户端无法解析 JSON, 错误以 trailers-only 响应返回
+	if err, ok := obj.(error); ok && isGRPC(c.Request) {
+		c.renderGRPCError(err)
+		return
+	}
+	if statusErr, ok := obj.(GRPCStatusError); ok {
+		obj = statusErr.Err
+	}
 	c.Status(code)
 	if obj == nil {
 		switch len(c.responses) {
@@ -261,27 +383,35 @@ func (c *Context) Render(code int, obj interface{}) {
 			if c.responses[0].Error != nil {
 				obj = c.responses[0].Error
 			} else {
-				res := H{}
-				if err := json.Unmarshal(c.responses[0].Response, &res); err != nil {
-					obj = string(c.responses[0].Response)
-				} else {
-					obj = res
-				}
+				obj = c.responses[0].value()
 			}
 		default:
 			combine := H{}
+			failures := H{}
 			// 合并返回
 			for i, l := 0, len(c.responses); i < l; i++ {
-				if c.responses[i].Error != nil {
+				var res interface{}
+				switch {
+				case c.responses[i].recovered():
+					// 可选节点失败 使用默认值
+					failures[c.responses[i].Attr] = c.responses[i].failure()
+					res, _ = decodeJSON([]byte(c.responses[i].fallback))
+				case c.responses[i].Error != nil:
 					combine[c.responses[i].Attr] = c.responses[i].Error
-				} else {
-					res := H{}
-					if err := json.Unmarshal(c.responses[i].Response, &res); err != nil {
-						combine[c.responses[i].Attr] = string(c.responses[i].Response)
-					} else {
-						combine[c.responses[i].Attr] = res
+					continue
+				default:
+					res = c.responses[i].value()
+				}
+				if fields, ok := res.(map[string]interface{}); ok && c.responses[i].flatten() {
+					for key, val := range fields {
+						combine[key] = val
 					}
+					continue
 				}
+				combine[c.responses[i].Attr] = res
+			}
+			if len(failures) > 0 {
+				combine[errorsAttr] = failures
 			}
 			obj = combine
 		}
@@ -325,16 +455,27 @@ func (c *Context) Stream(step func(w io.Writer) bool) {
 	}
 }
 
+// abortError . 请求被取消或超时时返回的错误
+func (c *Context) abortError() error {
+	if c.Err() == context.DeadlineExceeded {
+		return RequestTimeout
+	}
+	return RequestCanceled
+}
+
+// Deadline . 路由的超时时间
 func (c *Context) Deadline() (deadline time.Time, ok bool) {
-	return
+	return c.base().Deadline()
 }
 
+// Done . 客户端断开连接或超时时关闭
 func (c *Context) Done() <-chan struct{} {
-	return nil
+	return c.base().Done()
 }
 
+// Err . context.Canceled 或 context.DeadlineExceeded
 func (c *Context) Err() error {
-	return nil
+	return c.base().Err()
 }
 
 func (c *Context) Value(key interface{}) interface{} {
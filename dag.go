@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"strings"
+	"sync"
+)
+
+// nodeGraph . 节点的依赖关系
+// 节点通过 DependsOn 或 ParamFromNode 参数声明依赖, 没有依赖关系的节点并行执行
+type nodeGraph struct {
+	// 节点名 => 下标
+	index map[string]int
+	// 每个节点依赖的节点下标
+	deps [][]int
+	// 节点的返回值是否被其他节点引用
+	referenced []bool
+}
+
+// 解析 ParamFromNode 参数的节点名与 JSON 路径 例如 user.data.orgId => user, data.orgId
+func splitNodeAttr(attr string) (name, path string) {
+	if index := strings.IndexByte(attr, '.'); index != -1 {
+		return attr[:index], attr[index+1:]
+	}
+	return attr, ""
+}
+
+// newNodeGraph . 构建依赖关系 依赖的节点不存在或存在循环依赖时返回错误
+func newNodeGraph(nodes []Node) (*nodeGraph, error) {
+	num := len(nodes)
+	graph := &nodeGraph{
+		index:      make(map[string]int, num),
+		deps:       make([][]int, num),
+		referenced: make([]bool, num),
+	}
+	duplicated := make(map[string]bool)
+	for i := 0; i < num; i++ {
+		if _, ok := graph.index[nodes[i].Attr]; ok {
+			duplicated[nodes[i].Attr] = true
+			continue
+		}
+		graph.index[nodes[i].Attr] = i
+	}
+	for i := 0; i < num; i++ {
+		names := make([]string, 0, len(nodes[i].DependsOn))
+		names = append(names, nodes[i].DependsOn...)
+		for j, l := 0, len(nodes[i].ParamGroup); j < l; j++ {
+			if nodes[i].ParamGroup[j].From == ParamFromNode {
+				name, _ := splitNodeAttr(nodes[i].ParamGroup[j].Attr)
+				names = append(names, name)
+			}
+		}
+		for j, l := 0, len(names); j < l; j++ {
+			index, ok := graph.index[names[j]]
+			if !ok || duplicated[names[j]] {
+				return nil, NodeDependencyNotFound
+			}
+			if !containsIndex(graph.deps[i], index) {
+				graph.deps[i] = append(graph.deps[i], index)
+			}
+			graph.referenced[index] = true
+		}
+	}
+	if graph.cyclic() {
+		return nil, NodeDependencyCycle
+	}
+	return graph, nil
+}
+
+func containsIndex(indexes []int, index int) bool {
+	for i, l := 0, len(indexes); i < l; i++ {
+		if indexes[i] == index {
+			return true
+		}
+	}
+	return false
+}
+
+// 拓扑排序 判断是否存在循环依赖
+func (graph *nodeGraph) cyclic() bool {
+	num := len(graph.deps)
+	pending := make([]int, num)
+	dependents := make([][]int, num)
+	queue := make([]int, 0, num)
+	for i := 0; i < num; i++ {
+		pending[i] = len(graph.deps[i])
+		for _, dep := range graph.deps[i] {
+			dependents[dep] = append(dependents[dep], i)
+		}
+		if pending[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, next := range dependents[current] {
+			if pending[next]--; pending[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return visited != num
+}
+
+// dependencies . 节点依赖的节点下标
+func (graph *nodeGraph) dependencies(index int) []int {
+	if graph == nil {
+		return nil
+	}
+	return graph.deps[index]
+}
+
+// exported . 节点的返回值是否需要解析供其他节点使用
+func (graph *nodeGraph) exported(index int) bool {
+	return graph != nil && graph.referenced[index]
+}
+
+// run . 执行所有节点 依赖的节点执行完成后才会开始执行, 结果按 NodeGroup 的顺序返回
+func (graph *nodeGraph) run(ctx *Context, nodes []Node) []combineResponse {
+	num := len(nodes)
+	responses := make([]combineResponse, num)
+	// 每个节点写入各自的位置, 依赖的节点通过 done 保证先写入
+	ctx.outputs = make([]interface{}, num)
+	done := make([]chan struct{}, num)
+	for i := 0; i < num; i++ {
+		done[i] = make(chan struct{})
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(num)
+	for i := 0; i < num; i++ {
+		go func(index int) {
+			defer wg.Done()
+			defer close(done[index])
+			for _, dep := range graph.dependencies(index) {
+				<-done[dep]
+				if responses[dep].failed() {
+					responses[index] = nodes[index].result(NodeDependencyFailed)
+					return
+				}
+			}
+			responses[index] = nodes[index].Do(ctx)
+			if graph.exported(index) && responses[index].Error == nil {
+				ctx.outputs[index], _ = decodeJSON(responses[index].Response)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return responses
+}
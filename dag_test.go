@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNodeGraph(t *testing.T) {
+	fromNode := func(attr string) []Param {
+		return []Param{{Attr: attr, From: ParamFromNode, To: ParamFromQuery, ToName: "id"}}
+	}
+	if _, err := newNodeGraph([]Node{{Attr: "a"}, {Attr: "b", DependsOn: []string{"c"}}}); err != NodeDependencyNotFound {
+		t.Fatalf("expect %v got %v", NodeDependencyNotFound, err)
+	}
+	if _, err := newNodeGraph([]Node{
+		{Attr: "a", ParamGroup: fromNode("c.id")},
+		{Attr: "b", DependsOn: []string{"a"}},
+		{Attr: "c", DependsOn: []string{"b"}},
+	}); err != NodeDependencyCycle {
+		t.Fatalf("expect %v got %v", NodeDependencyCycle, err)
+	}
+	graph, err := newNodeGraph([]Node{
+		{Attr: "a"},
+		{Attr: "b", ParamGroup: fromNode("a.id"), DependsOn: []string{"a"}},
+		{Attr: "c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.deps[1]) != 1 || graph.deps[1][0] != 0 || !graph.referenced[0] || graph.referenced[2] {
+		t.Fatalf("unexpected graph %+v", graph)
+	}
+}
+
+func TestNodeChain(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"data":{"name":"u1","orgId":7}}`))
+		case "/org":
+			fmt.Fprintf(w, `{"id":"%s"}`, r.URL.Query().Get("orgId"))
+		case "/fail":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "chain"})
+	_, cluster := engine.Cluster("chain")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	err := engine.Route(RouteInfo{Method: "GET", URL: "/chain", NodeGroup: []Node{
+		{Attr: "org", Cluster: "chain", Rewrite: "/org", ParamGroup: []Param{
+			{Attr: "user.data.orgId", From: ParamFromNode, To: ParamFromQuery, ToName: "orgId", Required: true},
+		}},
+		{Attr: "user", Cluster: "chain", Rewrite: "/user"},
+		{Attr: "fail", Cluster: "chain", Rewrite: "/fail"},
+		{Attr: "after", Cluster: "chain", Rewrite: "/user", DependsOn: []string{"fail"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/chain", nil))
+	res := make(map[string]map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+	if res["org"]["id"] != "7" {
+		t.Fatalf("org should use orgId from user, got %s", w.Body.String())
+	}
+	if res["after"]["code"] != float64(-9036) {
+		t.Fatalf("node should fail with its dependency, got %s", w.Body.String())
+	}
+}
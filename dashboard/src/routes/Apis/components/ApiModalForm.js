@@ -7,6 +7,7 @@ import {
   Button,
   Form,
   Input,
+  InputNumber,
   Row,
   Col,
   Select,
@@ -62,6 +63,8 @@ const nodeInfo = {
   cluster: '',
   attr: '',
   rewrite: '',
+  grpcMethod: '',
+  thriftMethod: '',
   paramGroup: [
     paramInfo
   ]
@@ -76,6 +79,12 @@ export default class ApiModalForm extends Component {
       method: '',
       url: '',
       domain: '',
+      timeout: 0,
+      idleTimeout: 0,
+      passthrough: false,
+      stream: false,
+      statusPolicy: '',
+      responseHeaders: [],
       handlers: [],
       nodeGroup: []
     }
@@ -137,6 +146,63 @@ export default class ApiModalForm extends Component {
           />
         )}
         </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='Timeout'>
+          {form.getFieldDecorator('timeout')(
+            <InputNumber
+              min={0}
+              placeholder='ms'
+              onChange={(timeout) => this.setState({ timeout })}
+          />
+        )}
+        </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='IdleTimeout'>
+          {form.getFieldDecorator('idleTimeout')(
+            <InputNumber
+              min={0}
+              placeholder='WebSocket ms'
+              onChange={(idleTimeout) => this.setState({ idleTimeout })}
+          />
+        )}
+        </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='Passthrough'>
+          {form.getFieldDecorator('passthrough', { valuePropName: 'checked' })(
+            <Switch onChange={(passthrough) => this.setState({ passthrough })} />
+        )}
+        </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='Stream'>
+          {form.getFieldDecorator('stream', { valuePropName: 'checked' })(
+            <Switch onChange={(stream) => this.setState({ stream })} />
+        )}
+        </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='StatusPolicy'>
+          {form.getFieldDecorator('statusPolicy')(
+            <Select placeholder='always-200' onSelect={(statusPolicy) => this.setState({ statusPolicy })}>
+              <Option key='always-200' value='always-200'>always-200</Option>
+              <Option key='worst' value='worst'>worst</Option>
+              <Option key='first' value='first'>first</Option>
+            </Select>
+        )}
+        </FormItem>
+        <FormItem
+          {...formItemLayout}
+          label='ResponseHeaders'>
+          {form.getFieldDecorator('responseHeaders')(
+            <Select
+              mode='tags'
+              placeholder='e.g Set-Cookie'
+              onChange={(responseHeaders) => this.setState({ responseHeaders })} />
+        )}
+        </FormItem>
       </div>
     )
   }
@@ -160,6 +226,21 @@ export default class ApiModalForm extends Component {
     nodeGroup[index][key] = value
     this.setState({ nodeGroup })
   }
+  /**
+   * @description 响应映射 字段格式为 path 或 path=name
+   */
+  setResponseVal = (index, key, value) => {
+    const nodeGroup = this.state.nodeGroup
+    const response = nodeGroup[index].response || { fields: [], drop: [], flatten: false }
+    if (key === 'fields') {
+      value = value.map(field => {
+        const [path, name = ''] = field.split('=')
+        return { path, name }
+      })
+    }
+    nodeGroup[index].response = { ...response, [key]: value }
+    this.setState({ nodeGroup })
+  }
   setParamVal = (nodeIndex, paramIndex, key, val) => {
     const nodeGroup = this.state.nodeGroup
     nodeGroup[nodeIndex].paramGroup[paramIndex][key] = val
@@ -238,9 +319,111 @@ export default class ApiModalForm extends Component {
                 label='Rewrite'
                 colon={false}>
                 {form.getFieldDecorator(`nodeGroup[${index}].rewrite`, {
-                  rules: [{ required: true, message: 'rewrite is required' }]
+                  rules: [{ required: !nodeGroup[index].grpcMethod && !nodeGroup[index].thriftMethod, message: 'rewrite is required' }]
                 })(<Input placeholder='e.g /u' onChange={(e) => this.setNodeVal(index, 'rewrite', e.target.value)} />)}
               </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='GRPCMethod'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].grpcMethod`)(
+                  <Input placeholder='e.g user.UserService/Get' onChange={(e) => this.setNodeVal(index, 'grpcMethod', e.target.value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='ThriftMethod'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].thriftMethod`)(
+                  <Input placeholder='e.g UserService.get' onChange={(e) => this.setNodeVal(index, 'thriftMethod', e.target.value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='DependsOn'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].dependsOn`)(
+                  <Select
+                    mode='multiple'
+                    placeholder='e.g userInfo'
+                    onChange={(value) => this.setNodeVal(index, 'dependsOn', value)}>
+                    {nodeGroup.filter((node, ni) => ni !== index && node.attr).map(node => <Option
+                      key={node.attr}
+                      value={node.attr}>{node.attr}</Option>)}
+                  </Select>
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Timeout'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].timeout`)(
+                  <InputNumber
+                    min={0}
+                    placeholder='ms'
+                    onChange={(value) => this.setNodeVal(index, 'timeout', value || 0)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Required'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].required`, {
+                  valuePropName: 'checked',
+                  initialValue: !!item.required
+                })(
+                  <Switch onChange={(value) => this.setNodeVal(index, 'required', value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Fallback'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].fallback`)(
+                  <Input
+                    placeholder='e.g null | {} | {"list":[]}'
+                    disabled={!!item.required}
+                    onChange={(e) => this.setNodeVal(index, 'fallback', e.target.value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Fields'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].responseFields`, {
+                  initialValue: ((item.response && item.response.fields) || [])
+                    .map(field => field.name ? `${field.path}=${field.name}` : field.path)
+                })(
+                  <Select
+                    mode='tags'
+                    placeholder='e.g data.user.name=userName'
+                    onChange={(value) => this.setResponseVal(index, 'fields', value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Drop'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].responseDrop`, {
+                  initialValue: (item.response && item.response.drop) || []
+                })(
+                  <Select
+                    mode='tags'
+                    placeholder='e.g data.password'
+                    onChange={(value) => this.setResponseVal(index, 'drop', value)} />
+                  )}
+              </FormItem>
+              <FormItem
+                {...formNodeItemLayout}
+                label='Flatten'
+                colon={false}>
+                {form.getFieldDecorator(`nodeGroup[${index}].responseFlatten`, {
+                  valuePropName: 'checked',
+                  initialValue: !!(item.response && item.response.flatten)
+                })(
+                  <Switch onChange={(value) => this.setResponseVal(index, 'flatten', value)} />
+                  )}
+              </FormItem>
             </Col>
             <Col span={2} offset={1}>
               { index === 0
@@ -283,6 +466,9 @@ export default class ApiModalForm extends Component {
                                 <Option value={1}>Header</Option>
                                 <Option value={2}>Query</Option>
                                 <Option value={3}>Body</Option>
+                                <Option value={4}>Path</Option>
+                                <Option value={5}>Node</Option>
+                                <Option value={6}>JSON</Option>
                               </Select>)}
                           </FormItem>
                         </Col>
@@ -296,6 +482,8 @@ export default class ApiModalForm extends Component {
                                 <Option value={1}>Header</Option>
                                 <Option value={2}>Query</Option>
                                 <Option value={3}>Body</Option>
+                                <Option value={4}>Path</Option>
+                                <Option value={6}>JSON</Option>
                               </Select>)}
                           </FormItem>
                         </Col>
@@ -375,7 +563,13 @@ export default class ApiModalForm extends Component {
                   name: this.state.name,
                   method: this.state.method,
                   url: this.state.url,
-                  domain: this.state.domain
+                  domain: this.state.domain,
+                  timeout: this.state.timeout,
+                  idleTimeout: this.state.idleTimeout,
+                  passthrough: this.state.passthrough,
+                  stream: this.state.stream,
+                  statusPolicy: this.state.statusPolicy,
+                  responseHeaders: this.state.responseHeaders
                 })
                 clearTimeout(timeout)
               }, 500)
@@ -433,6 +627,12 @@ export default class ApiModalForm extends Component {
                   method: this.state.method,
                   url: this.state.url,
                   domain: this.state.domain,
+                  timeout: this.state.timeout || 0,
+                  idleTimeout: this.state.idleTimeout || 0,
+                  passthrough: this.state.passthrough,
+                  stream: this.state.stream,
+                  statusPolicy: this.state.statusPolicy,
+                  responseHeaders: this.state.responseHeaders,
                   handlers: this.state.handlers,
                   nodeGroup: this.state.nodeGroup
                 })
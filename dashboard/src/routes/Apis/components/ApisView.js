@@ -52,6 +52,11 @@ export default class ApisView extends Component {
         dataIndex: 'url',
         key: 'url'
       },
+      {
+        title: 'Domain',
+        dataIndex: 'domain',
+        key: 'domain'
+      },
       {
         title: 'Handlers',
         key: 'handles',
@@ -95,7 +100,13 @@ export default class ApisView extends Component {
         name: data.name,
         method: data.method,
         url: data.url,
-        domain: data.domain
+        domain: data.domain,
+        timeout: data.timeout,
+        idleTimeout: data.idleTimeout,
+        passthrough: data.passthrough,
+        stream: data.stream,
+        statusPolicy: data.statusPolicy,
+        responseHeaders: data.responseHeaders || []
       })
       modify = true
       title = `编辑:[${data.url}]`
@@ -124,6 +135,7 @@ export default class ApisView extends Component {
       uri = '/v1/api/update'
       values = {
         info,
+        domain: this.state.currentData.domain,
         method: this.state.currentData.method,
         url: this.state.currentData.url
       }
@@ -158,6 +170,7 @@ export default class ApisView extends Component {
     fetch('/v1/api/delete',
       { method: 'POST',
         body: JSON.stringify({
+          domain: value.domain,
           method: value.method,
           url: value.url
         })
@@ -197,7 +210,7 @@ export default class ApisView extends Component {
           <Table
             columns={this.getBackendsTableColums()}
             dataSource={items}
-            rowKey={(record) => record.url}
+            rowKey={(record) => `${record.domain}-${record.method}-${record.url}`}
         />
         </Spin>
         <ApiModalFormComponent
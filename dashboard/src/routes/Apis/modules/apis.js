@@ -84,7 +84,9 @@ const ACTION_HANDLERS = {
   [API_UPDATE]: (state, action) => {
     // edit
     for (let i = 0; i < state.items.length; i++) {
-      if (state.items[i].method === action.payload.method && state.items[i].url === action.payload.url) {
+      if (state.items[i].domain === action.payload.domain &&
+        state.items[i].method === action.payload.method &&
+        state.items[i].url === action.payload.url) {
         state.items[i] = action.payload.info
       }
     }
@@ -93,7 +95,9 @@ const ACTION_HANDLERS = {
   [API_DELETE]: (state, action) => {
     // edit
     for (let i = 0; i < state.items.length; i++) {
-      if (state.items[i].method === action.payload.method && state.items[i].url === action.payload.url) {
+      if (state.items[i].domain === action.payload.domain &&
+        state.items[i].method === action.payload.method &&
+        state.items[i].url === action.payload.url) {
         state.items.splice(i, 1)
       }
     }
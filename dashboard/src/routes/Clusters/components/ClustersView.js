@@ -1,8 +1,11 @@
 import React, { Component } from 'react'
 import PropTypes from 'prop-types'
-import { Table, Spin, Form, Modal, Input, Breadcrumb, Button, message } from 'antd'
+import { Table, Spin, Form, Modal, Input, InputNumber, Select, Switch, Breadcrumb, Button, message } from 'antd'
 
 const FormItem = Form.Item
+const Option = Select.Option
+const loadBalances = ['least-conn', 'round-robin', 'weighted-round-robin', 'random-two-choices', 'ewma', 'consistent-hash']
+const hashOns = ['header', 'query', 'cookie', 'userId', 'ip']
 const formItemLayout = {
   labelCol: {
     xs: { span: 24 },
@@ -47,6 +50,65 @@ const ClusterModifyForm = Form.create()(
               <Input type='textarea' rows={4} />
             )}
           </FormItem>
+          <FormItem
+            {...formItemLayout}
+            label='LoadBalance'>
+            {getFieldDecorator('loadBalance', {
+              initialValue: 'least-conn'
+            })(
+              <Select>
+                {loadBalances.map(item => <Option key={item} value={item}>{item}</Option>)}
+              </Select>
+            )}
+          </FormItem>
+          {form.getFieldValue('loadBalance') === 'consistent-hash' && <FormItem
+            {...formItemLayout}
+            label='HashOn'>
+            {getFieldDecorator('hashOn', {
+              initialValue: 'ip'
+            })(
+              <Select>
+                {hashOns.map(item => <Option key={item} value={item}>{item}</Option>)}
+              </Select>
+            )}
+          </FormItem>}
+          {form.getFieldValue('loadBalance') === 'consistent-hash' && <FormItem
+            {...formItemLayout}
+            label='HashKey'>
+            {getFieldDecorator('hashKey')(
+              <Input placeholder='e.g X-User-Id' />
+            )}
+          </FormItem>}
+          <FormItem
+            {...formItemLayout}
+            label='OutlierDetection'>
+            {getFieldDecorator('outlier.enabled', {
+              valuePropName: 'checked'
+            })(
+              <Switch />
+            )}
+          </FormItem>
+          <FormItem
+            {...formItemLayout}
+            label='Consecutive5xx'>
+            {getFieldDecorator('outlier.consecutive5xx')(
+              <InputNumber min={1} placeholder='5' />
+            )}
+          </FormItem>
+          <FormItem
+            {...formItemLayout}
+            label='BaseEjectionSeconds'>
+            {getFieldDecorator('outlier.baseEjectionTime')(
+              <InputNumber min={1} placeholder='30' />
+            )}
+          </FormItem>
+          <FormItem
+            {...formItemLayout}
+            label='MaxEjectionPercent'>
+            {getFieldDecorator('outlier.maxEjectionPercent')(
+              <InputNumber min={1} max={100} placeholder='50' />
+            )}
+          </FormItem>
         </Form>
       </Modal>
     )
@@ -82,6 +144,11 @@ export default class Clusters extends Component {
         dataIndex: 'description',
         key: 'description'
       },
+      {
+        title: '负载均衡',
+        dataIndex: 'loadBalance',
+        key: 'loadBalance'
+      },
       {
         title: '服务数量',
         dataIndex: 'backendNum',
@@ -120,7 +187,11 @@ export default class Clusters extends Component {
     if (data) {
       form.setFieldsValue({
         name: data.clusterName,
-        description: data.description
+        description: data.description,
+        loadBalance: data.loadBalance || 'least-conn',
+        hashOn: data.hashOn,
+        hashKey: data.hashKey,
+        outlier: data.outlier
       })
       modify = true
       title = `编辑:[${data.clusterName}]`
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type (
+	// DescriptorGroup . 已注册的 protobuf 描述集 用于 gRPC 转码
+	DescriptorGroup struct {
+		rwMutex sync.RWMutex
+		sets    map[string]*protoregistry.Files
+	}
+	// DescriptorSetInfo . 描述集中包含的服务
+	DescriptorSetInfo struct {
+		Name     string   `json:"name"`
+		Services []string `json:"services"`
+	}
+)
+
+// parseDescriptorSet . 解析 protoc --include_imports --descriptor_set_out 生成的描述集
+func parseDescriptorSet(data []byte) (*protoregistry.Files, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, DescriptorSetNotValid
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, DescriptorSetNotValid
+	}
+	return files, nil
+}
+
+// Add . 注册描述集 同名的描述集会被替换
+func (group *DescriptorGroup) Add(name string, data []byte) error {
+	files, err := parseDescriptorSet(data)
+	if err != nil {
+		return err
+	}
+	group.rwMutex.Lock()
+	defer group.rwMutex.Unlock()
+	if group.sets == nil {
+		group.sets = make(map[string]*protoregistry.Files)
+	}
+	group.sets[name] = files
+	return nil
+}
+
+// Remove . 移除描述集
+func (group *DescriptorGroup) Remove(name string) error {
+	group.rwMutex.Lock()
+	defer group.rwMutex.Unlock()
+	if _, ok := group.sets[name]; !ok {
+		return DescriptorSetNotFound
+	}
+	delete(group.sets, name)
+	return nil
+}
+
+// Sets . 所有的描述集
+func (group *DescriptorGroup) Sets() []DescriptorSetInfo {
+	group.rwMutex.RLock()
+	defer group.rwMutex.RUnlock()
+	infos := make([]DescriptorSetInfo, 0, len(group.sets))
+	for name, files := range group.sets {
+		info := DescriptorSetInfo{Name: name, Services: make([]string, 0)}
+		files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+			services := file.Services()
+			for i, l := 0, services.Len(); i < l; i++ {
+				info.Services = append(info.Services, string(services.Get(i).FullName()))
+			}
+			return true
+		})
+		sort.Strings(info.Services)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// method . 按 package.Service/Method 查找方法
+func (group *DescriptorGroup) method(name string) (protoreflect.MethodDescriptor, error) {
+	index := strings.LastIndexByte(name, '/')
+	if index == -1 {
+		return nil, GRPCMethodNotFound
+	}
+	service, method := protoreflect.FullName(strings.TrimPrefix(name[:index], "/")), protoreflect.Name(name[index+1:])
+	group.rwMutex.RLock()
+	defer group.rwMutex.RUnlock()
+	for _, files := range group.sets {
+		desc, err := files.FindDescriptorByName(service)
+		if err != nil {
+			continue
+		}
+		if serviceDesc, ok := desc.(protoreflect.ServiceDescriptor); ok {
+			if methodDesc := serviceDesc.Methods().ByName(method); methodDesc != nil {
+				return methodDesc, nil
+			}
+		}
+	}
+	return nil, GRPCMethodNotFound
+}
@@ -5,16 +5,20 @@ import (
 	"log"
 	"net/http"
 	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type (
 	// Engine .
 	Engine struct {
-		pool       sync.Pool
-		clientPool sync.Pool
+		pool sync.Pool
 
-		routeTable *RouteTable
-		clusters   *ClusterGroup
+		routeTable  *RouteTable
+		clusters    *ClusterGroup
+		descriptors *DescriptorGroup
+		thriftIDLs  *ThriftIDLGroup
 
 		plugins HandlesChain
 	}
@@ -25,16 +29,15 @@ type (
 
 func New() *Engine {
 	engine := &Engine{
-		routeTable: NewRouteTable(),
-		clusters:   &ClusterGroup{},
-		plugins:    make(HandlesChain, 0),
+		routeTable:  NewRouteTable(),
+		clusters:    &ClusterGroup{},
+		descriptors: &DescriptorGroup{},
+		thriftIDLs:  &ThriftIDLGroup{},
+		plugins:     make(HandlesChain, 0),
 	}
 	engine.pool.New = func() interface{} {
 		return engine.allocateContext()
 	}
-	engine.clientPool.New = func() interface{} {
-		return &http.Client{}
-	}
 	engine.RegisterPlugin(Proxy{})
 	engine.RegisterPlugin(NewRecovery())
 	return engine
@@ -87,17 +90,6 @@ func (engine *Engine) Plugins() []PluginInfo {
 	return plugins
 }
 
-// Client Get http client .
-func (engine *Engine) Client() *http.Client {
-	return engine.clientPool.Get().(*http.Client)
-}
-
-// Release .
-func (engine *Engine) Release(client *http.Client) {
-	client.Timeout = 10
-	engine.clientPool.Put(client)
-}
-
 // AddCluster .
 func (engine *Engine) AddCluster(cluster *Cluster) error {
 	return engine.clusters.Add(cluster)
@@ -109,8 +101,8 @@ func (engine *Engine) RemoveCluster(clusterName string) error {
 }
 
 // Update .
-func (engine *Engine) Update(cluster *Cluster) {
-	engine.clusters.Update(cluster)
+func (engine *Engine) Update(cluster *Cluster) error {
+	return engine.clusters.Update(cluster)
 }
 
 // Cluster .
@@ -123,6 +115,36 @@ func (engine *Engine) Clusters() []*Cluster {
 	return engine.clusters.Clusters()
 }
 
+// AddDescriptorSet . 注册 protobuf 描述集 节点通过 GRPCMethod 转码调用 gRPC 后端服务
+func (engine *Engine) AddDescriptorSet(name string, data []byte) error {
+	return engine.descriptors.Add(name, data)
+}
+
+// RemoveDescriptorSet .
+func (engine *Engine) RemoveDescriptorSet(name string) error {
+	return engine.descriptors.Remove(name)
+}
+
+// DescriptorSets .
+func (engine *Engine) DescriptorSets() []DescriptorSetInfo {
+	return engine.descriptors.Sets()
+}
+
+// AddThriftIDL . 注册 thrift IDL 节点通过 ThriftMethod 调用 thrift 后端服务
+func (engine *Engine) AddThriftIDL(name string, content string) error {
+	return engine.thriftIDLs.Add(name, content)
+}
+
+// RemoveThriftIDL .
+func (engine *Engine) RemoveThriftIDL(name string) error {
+	return engine.thriftIDLs.Remove(name)
+}
+
+// ThriftIDLs .
+func (engine *Engine) ThriftIDLs() []ThriftIDLInfo {
+	return engine.thriftIDLs.IDLs()
+}
+
 func (engine *Engine) combinePlugins(routeInfo RouteInfo) RouteInfo {
 	_, recovery := engine.Plugin("recovery")
 	routeInfo.handles = append(routeInfo.handles, recovery)
@@ -145,14 +167,14 @@ func (engine *Engine) Route(routeInfo RouteInfo) error {
 }
 
 // UnRoute .
-func (engine *Engine) UnRoute(method, url string) {
-	engine.routeTable.Remove(method, url)
+func (engine *Engine) UnRoute(domain, method, url string) {
+	engine.routeTable.Remove(domain, method, url)
 }
 
 // UpdateRoute .
-func (engine *Engine) UpdateRoute(method, url string, routeInfo RouteInfo) {
+func (engine *Engine) UpdateRoute(domain, method, url string, routeInfo RouteInfo) error {
 	routeInfo = engine.combinePlugins(routeInfo)
-	engine.routeTable.Update(method, url, routeInfo)
+	return engine.routeTable.Update(domain, method, url, routeInfo)
 }
 
 // Routes .
@@ -160,17 +182,22 @@ func (engine *Engine) Routes() []RouteInfo {
 	return engine.routeTable.tables
 }
 
+// Handler . 同时支持 HTTP/1.1 与 h2c (不加密的 HTTP/2), gRPC 客户端可以直接访问
+func (engine *Engine) Handler() http.Handler {
+	return h2c.NewHandler(engine, &http2.Server{})
+}
+
 // Run .
 func (engine *Engine) Run(addr string) (err error) {
 	defer func() {
 		log.Printf("[Gateway]%s", err.Error())
 	}()
 	fmt.Println("Gateway Listening and serving HTTP on ", addr)
-	err = http.ListenAndServe(addr, engine)
+	err = http.ListenAndServe(addr, engine.Handler())
 	return
 }
 
-// RunTLS .
+// RunTLS . 通过 ALPN 协商 HTTP/2
 func (engine *Engine) RunTLS(addr string, certFile string, keyFile string) (err error) {
 	defer func() {
 		log.Printf("[Gateway]%s", err.Error())
@@ -195,10 +222,13 @@ func (engine *Engine) handleHTTPRequest(context *Context) {
 	httpMethod := context.Request.Method
 	path := context.Request.URL.Path
 	// parse request
-	has, routeInfo := engine.routeTable.Get(httpMethod, path)
+	has, routeInfo, params := engine.routeTable.Get(context.Request.Host, httpMethod, path)
 	if has {
+		context.Params = params
 		context.routeInfo = routeInfo
 		context.handlers = routeInfo.handles
+		context.withTimeout(routeInfo.Timeout)
+		defer context.release()
 		context.Next()
 		return
 	}
@@ -209,4 +239,17 @@ type combineResponse struct {
 	Attr     string
 	Error    error
 	Response []byte
+	// 后端服务的状态码与响应头 没有收到响应时为空
+	Status int
+	Header http.Header
+	// 响应由网关编码为 JSON (thrift), 非对象的值同样按 JSON 解析
+	encoded bool
+
+	// 节点每次请求的执行信息
+	execInfoGroup []ExecInfo
+	// 节点的响应映射
+	mapping *ResponseMapping
+	// 是否为必要节点 以及可选节点失败时的默认值
+	required bool
+	fallback string
 }
@@ -1,10 +1,16 @@
 package gateway
 
 import (
+    "encoding/json"
+    "net"
+    "sync/atomic"
+    "sync"
     "testing"
     "net/http"
-    "sync"
+    "net/http/httptest"
     "fmt"
+    "strings"
+    "time"
 )
 
 func TestRace(t *testing.T) {
@@ -26,6 +32,142 @@ func TestRace(t *testing.T) {
     runRequest(t, engine, "GET", "/login")
 }
 
+func TestProxyFanOut(t *testing.T) {
+    backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // 倒序返回, 验证合并结果与完成顺序无关
+        delay := map[string]time.Duration{"/a": 30, "/b": 20, "/c": 10}[r.URL.Path]
+        time.Sleep(delay * time.Millisecond)
+        fmt.Fprintf(w, `{"path":"%s","name":"%s"}`, r.URL.Path, r.FormValue("name"))
+    }))
+    defer backend.Close()
+    engine := New()
+    engine.RegisterPlugin(Proxy{})
+    engine.AddCluster(&Cluster{Name: "FanOutCluster"})
+    _, cluster := engine.Cluster("FanOutCluster")
+    cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+    nodeGroup := make([]Node, 0)
+    for _, attr := range []string{"a", "b", "c"} {
+        nodeGroup = append(nodeGroup, Node{
+            Attr: attr,
+            Cluster: "FanOutCluster",
+            Rewrite: "/" + attr,
+            ParamGroup: []Param{
+                Param{Attr: "name", From: ParamFromBody, To: ParamFromQuery, ToName: "name"},
+            },
+        })
+    }
+    engine.Route(RouteInfo{Name: "合并接口", Method: "POST", URL: "/combine", NodeGroup: nodeGroup})
+    wg := &sync.WaitGroup{}
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            req := httptest.NewRequest("POST", "/combine?debug=true", strings.NewReader(fmt.Sprintf("name=n%d", i)))
+            req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+            w := httptest.NewRecorder()
+            engine.ServeHTTP(w, req)
+            var res struct {
+                Exec     []ExecInfo                   `json:"exec"`
+                Response map[string]map[string]string `json:"response"`
+            }
+            if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+                t.Error(err, w.Body.String())
+                return
+            }
+            for j, attr := range []string{"a", "b", "c"} {
+                if res.Response[attr]["path"] != "/"+attr || res.Response[attr]["name"] != fmt.Sprintf("n%d", i) {
+                    t.Errorf("unexpected response %s", w.Body.String())
+                }
+                if !strings.Contains(res.Exec[j].BackendURI, "/"+attr+"?") {
+                    t.Errorf("exec info should follow node order %+v", res.Exec)
+                }
+            }
+        }(i)
+    }
+    wg.Wait()
+}
+
+func TestRouteTimeout(t *testing.T) {
+    slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-r.Context().Done():
+        case <-time.After(time.Second):
+        }
+    }))
+    defer slow.Close()
+    engine := New()
+    engine.RegisterPlugin(Proxy{})
+    engine.AddCluster(&Cluster{Name: "SlowCluster"})
+    _, cluster := engine.Cluster("SlowCluster")
+    cluster.Add(&Backend{Addr: strings.TrimPrefix(slow.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+    engine.Route(RouteInfo{
+        Name: "慢接口",
+        Method:"GET",
+        URL:"/slow",
+        Timeout: 50,
+        NodeGroup: []Node{
+            Node{Attr: "a", Cluster:"SlowCluster", Rewrite: "/a"},
+            Node{Attr: "b", Cluster:"SlowCluster", Rewrite: "/b"},
+        },
+    })
+    w := httptest.NewRecorder()
+    now := time.Now()
+    engine.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+    if elapsed := time.Since(now); elapsed > 500*time.Millisecond {
+        t.Fatalf("request should be cancelled after route timeout, took %s", elapsed)
+    }
+    if strings.Count(w.Body.String(), "-9033") != 2 {
+        t.Fatalf("unexpected response %s", w.Body.String())
+    }
+    if state := cluster.Backends()[0].Circuit; state != nil && state.State() != CircuitClosed {
+        t.Fatal("cancelled requests should not trip the breaker")
+    }
+}
+
+func TestNodeTimeout(t *testing.T) {
+    slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-r.Context().Done():
+        case <-time.After(time.Second):
+        }
+    }))
+    defer slow.Close()
+    engine := New()
+    engine.RegisterPlugin(Proxy{})
+    engine.AddCluster(&Cluster{Name: "SlowCluster"})
+    _, cluster := engine.Cluster("SlowCluster")
+    backend := &Backend{Addr: strings.TrimPrefix(slow.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5}
+    cluster.Add(backend)
+    node := Node{Attr: "a", Cluster:"SlowCluster", Rewrite: "/a", Timeout: 50}
+    ctx := engine.allocateContext()
+    ctx.reset()
+    if timeout := node.timeout(ctx, backend); timeout != 50*time.Millisecond {
+        t.Fatalf("node timeout should be used, got %s", timeout)
+    }
+    ctx.Request = httptest.NewRequest("GET", "/", nil)
+    ctx.withTimeout(20)
+    defer ctx.release()
+    if timeout := node.timeout(ctx, backend); timeout > 20*time.Millisecond {
+        t.Fatalf("remaining route budget should be used, got %s", timeout)
+    }
+    engine.Route(RouteInfo{
+        Name: "慢接口",
+        Method:"GET",
+        URL:"/slow",
+        Timeout: 1000,
+        NodeGroup: []Node{node},
+    })
+    w := httptest.NewRecorder()
+    now := time.Now()
+    engine.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+    if elapsed := time.Since(now); elapsed > 500*time.Millisecond {
+        t.Fatalf("request should be cancelled after node timeout, took %s", elapsed)
+    }
+    if !strings.Contains(w.Body.String(), "-9039") {
+        t.Fatalf("unexpected response %s", w.Body.String())
+    }
+}
+
 func BenchmarkEngineOneRouter(b *testing.B) {
     engine := New()
     engine.RegisterPlugin(Proxy{})
@@ -66,38 +208,44 @@ func BenchmarkEngineMultiRouter(b *testing.B) {
     runRequestBenchmark(b, engine, "GET", "/login")
 }
 
-type Proxy struct {
-
-}
-
-func (p Proxy)Name()string {
-    return "proxy"
-}
-
-func (p Proxy)Version()string {
-    return "0.1"
-}
-
-func (p Proxy)Handle(ctx *Context) {
-    ctx.Writer.Header().Set("Server", "Gate 0.1")
-    nodes := len(ctx.RouteInfo().NodeGroup)
-    switch nodes {
-    case 0:
-        ctx.JSON(BackendServiceError)
-        return
-    case 1:
-        // 执行单个节点
-        ctx.RouteInfo().NodeGroup[0].Do(ctx, nil)
-    default:
-        // 合并执行多个节点
-        wg := &sync.WaitGroup{}
-        wg.Add(nodes)
-        for i := 0; i < nodes; i++ {
-            go ctx.RouteInfo().NodeGroup[i].Do(ctx, wg)
+// 统计后端服务建立的连接数, 连接复用时约等于并发数而不是请求数
+func BenchmarkBackendConnectionReuse(b *testing.B) {
+    var conns int64
+    server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(`{"ok":true}`))
+    }))
+    server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+        if state == http.StateNew {
+            atomic.AddInt64(&conns, 1)
         }
-        wg.Wait()
     }
-    ctx.Render()
+    server.Start()
+    defer server.Close()
+    engine := New()
+    engine.RegisterPlugin(Proxy{})
+    engine.AddCluster(&Cluster{Name: "BenchCluster"})
+    _, cluster := engine.Cluster("BenchCluster")
+    cluster.Add(&Backend{Addr: strings.TrimPrefix(server.URL, "http://"), Schema: "http", HeartDisabled: true})
+    engine.Route(RouteInfo{
+        Name: "压测接口",
+        Method:"GET",
+        URL:"/bench",
+        NodeGroup: []Node{
+            Node{Attr: "info", Cluster:"BenchCluster", Rewrite: "/"},
+        },
+    })
+    b.ReportAllocs()
+    b.SetParallelism(8)
+    b.ResetTimer()
+    b.RunParallel(func(pb *testing.PB) {
+        req := httptest.NewRequest("GET", "/bench", nil)
+        w := newMockWriter()
+        for pb.Next() {
+            engine.ServeHTTP(w, req)
+        }
+    })
+    b.StopTimer()
+    b.ReportMetric(float64(atomic.LoadInt64(&conns)), "conns")
 }
 
 type mockWriter struct {
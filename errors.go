@@ -33,6 +33,30 @@ var (
 	TokenServiceConnectFailed = errors.New(-9025, "授权服务连接失败")
 
 	BackendsNumNotZero = errors.New(-9026, "已经绑定了Backend")
+	RouteConflict      = errors.New(-9027, "路由规则冲突")
+	DomainNotValid     = errors.New(-9028, "域名格式错误")
+	BalancerUnknowable = errors.New(-9029, "无法识别的负载均衡策略")
+	HashKeyNotValid    = errors.New(-9030, "一致性哈希配置错误")
+	BackendQPSExceeded = errors.New(-9031, "后端服务超过最大QPS")
+	RequestCanceled    = errors.New(-9032, "请求已取消")
+	RequestTimeout     = errors.New(-9033, "请求超时")
+
+	NodeDependencyNotFound = errors.New(-9034, "依赖的节点不存在")
+	NodeDependencyCycle    = errors.New(-9035, "节点存在循环依赖")
+	NodeDependencyFailed   = errors.New(-9036, "依赖的节点执行失败")
+	StatusPolicyUnknowable = errors.New(-9037, "无法识别的状态码策略")
+	FallbackNotValid       = errors.New(-9038, "节点默认值不是合法的JSON")
+	BackendTimeout         = errors.New(-9039, "后端服务超时")
+	TLSConfigNotValid      = errors.New(-9040, "TLS 配置错误")
+	HealthCheckNotValid    = errors.New(-9041, "健康检查配置错误")
+	DescriptorSetNotValid  = errors.New(-9042, "protobuf 描述集解析失败")
+	DescriptorSetNotFound  = errors.New(-9043, "protobuf 描述集不存在")
+	GRPCMethodNotFound     = errors.New(-9044, "gRPC 方法不存在或不是 unary 方法")
+	GRPCMessageNotValid    = errors.New(-9045, "gRPC 消息转换失败")
+	ThriftIDLNotValid      = errors.New(-9046, "thrift IDL 解析失败")
+	ThriftIDLNotFound      = errors.New(-9047, "thrift IDL 不存在")
+	ThriftMethodNotFound   = errors.New(-9048, "thrift 方法不存在或是 oneway 方法")
+	ThriftMessageNotValid  = errors.New(-9049, "thrift 参数转换失败")
 
 	SUCCESS = errors.New(0, "操作成功")
 )
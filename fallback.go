@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// 失败的可选节点的错误信息在合并结果中的字段名
+const errorsAttr = "_errors"
+
+// failed . 节点是否执行失败 请求出错或后端服务返回 5xx
+func (response combineResponse) failed() bool {
+	return response.Error != nil || response.Status >= http.StatusInternalServerError
+}
+
+// recovered . 可选节点失败后使用了默认值
+func (response combineResponse) recovered() bool {
+	return response.fallback != "" && response.failed()
+}
+
+// failure . 节点失败的原因
+func (response combineResponse) failure() error {
+	if response.Error != nil {
+		return response.Error
+	}
+	return BackendServiceError
+}
+
+// validFallback . 默认值需要是合法的 JSON 例如 null | {} | {"list":[]}
+func validFallback(nodes []Node) bool {
+	for i, l := 0, len(nodes); i < l; i++ {
+		if nodes[i].Fallback != "" && !json.Valid([]byte(nodes[i].Fallback)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredFailure . 合并多个节点时, 第一个执行失败的必要节点的错误
+func (c *Context) requiredFailure() error {
+	if len(c.responses) < 2 {
+		return nil
+	}
+	for i, l := 0, len(c.responses); i < l; i++ {
+		if c.responses[i].required && c.responses[i].failed() {
+			return c.responses[i].failure()
+		}
+	}
+	return nil
+}
+
+// failureStatus . 必要节点失败时的状态码
+func failureStatus(err error) int {
+	if err == RequestTimeout || err == BackendTimeout {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
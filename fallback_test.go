@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxy_PartialFailure(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "partial"})
+	_, cluster := engine.Cluster("partial")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	if err := engine.Route(RouteInfo{Method: "GET", URL: "/invalid", NodeGroup: []Node{{Fallback: "{"}}}); err != FallbackNotValid {
+		t.Fatalf("expect %v got %v", FallbackNotValid, err)
+	}
+	engine.Route(RouteInfo{Method: "GET", URL: "/optional", StatusPolicy: StatusWorst, NodeGroup: []Node{
+		{Attr: "main", Cluster: "partial", Rewrite: "/up", Required: true},
+		{Attr: "ads", Cluster: "partial", Rewrite: "/down", Fallback: `{"list":[]}`},
+		{Attr: "tips", Cluster: "missing", Fallback: "null"},
+	}})
+	engine.Route(RouteInfo{Method: "GET", URL: "/required", NodeGroup: []Node{
+		{Attr: "main", Cluster: "partial", Rewrite: "/down", Required: true},
+		{Attr: "ads", Cluster: "partial", Rewrite: "/up"},
+	}})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/optional", nil))
+	var res map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	errs, _ := res["_errors"].(map[string]interface{})
+	if w.Code != http.StatusOK || res["tips"] != nil || len(errs) != 2 || errs["ads"] == nil {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if ads, _ := res["ads"].(map[string]interface{}); ads == nil || ads["list"] == nil {
+		t.Fatalf("optional node should use fallback %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/required", nil))
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "-9003") {
+		t.Fatalf("required node failure should fail the request, got %d %s", w.Code, w.Body.String())
+	}
+}
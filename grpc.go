@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	grpcContentType        = "application/grpc"
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// gRPC-Web 中 trailer 帧的标记位
+	grpcWebTrailerFlag = 0x80
+)
+
+// gRPC 状态码 网关或插件返回错误时使用
+const (
+	GRPCCanceled          = 1
+	GRPCDeadlineExceeded  = 4
+	GRPCResourceExhausted = 8
+	GRPCUnimplemented     = 12
+	GRPCUnavailable       = 14
+	GRPCUnauthenticated   = 16
+)
+
+// GRPCStatusError . 插件返回的错误指定 gRPC 状态码, 非 gRPC 请求按 Err 渲染
+type GRPCStatusError struct {
+	Status int
+	Err    error
+}
+
+func (e GRPCStatusError) Error() string {
+	return e.Err.Error()
+}
+
+// isGRPC . 是否为 gRPC 或 gRPC-Web 请求
+func isGRPC(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), grpcContentType)
+}
+
+// isGRPCWeb . 是否为 gRPC-Web 请求
+func isGRPCWeb(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// isGRPCWebText . 是否为 base64 编码的 gRPC-Web 请求
+func isGRPCWebText(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), grpcWebTextContentType)
+}
+
+// grpcFrame . gRPC 消息帧 1字节标记 + 4字节长度 + 消息
+func grpcFrame(flag byte, message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// grpcWebRequest . gRPC-Web 请求转为 gRPC 请求 application/grpc-web-text+proto => application/grpc+proto
+func grpcWebRequest(req *http.Request, body io.Reader) io.Reader {
+	contentType := req.Header.Get("Content-Type")
+	if isGRPCWebText(req) {
+		contentType = grpcContentType + strings.TrimPrefix(contentType, grpcWebTextContentType)
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	} else {
+		contentType = grpcContentType + strings.TrimPrefix(contentType, grpcWebContentType)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	return body
+}
+
+// grpcWebResponse . gRPC 响应转为 gRPC-Web 响应 trailer 作为最后一帧写入响应体
+func grpcWebResponse(res *http.Response, text bool) io.Reader {
+	contentType := res.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, grpcContentType) {
+		return res.Body
+	}
+	// 响应体增加了 trailer 帧, 长度不再准确
+	res.Header.Del("Content-Length")
+	body := io.MultiReader(res.Body, &grpcWebTrailer{res: res})
+	if text {
+		res.Header.Set("Content-Type", grpcWebTextContentType+strings.TrimPrefix(contentType, grpcContentType))
+		return &base64Reader{reader: body}
+	}
+	res.Header.Set("Content-Type", grpcWebContentType+strings.TrimPrefix(contentType, grpcContentType))
+	return body
+}
+
+// grpcWebTrailer . 后端服务的响应体读取完成后生成 trailer 帧
+type grpcWebTrailer struct {
+	res   *http.Response
+	frame *bytes.Reader
+}
+
+func (trailer *grpcWebTrailer) Read(p []byte) (int, error) {
+	if trailer.frame == nil {
+		var buf bytes.Buffer
+		for key, values := range trailer.res.Trailer {
+			for _, value := range values {
+				buf.WriteString(strings.ToLower(key) + ": " + value + "\r\n")
+			}
+		}
+		frame := make([]byte, 5, 5+buf.Len())
+		if buf.Len() > 0 {
+			frame[0] = grpcWebTrailerFlag
+			binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+			frame = append(frame, buf.Bytes()...)
+		} else {
+			// trailers-only 响应 状态已经在响应头中
+			frame = frame[:0]
+		}
+		trailer.frame = bytes.NewReader(frame)
+	}
+	return trailer.frame.Read(p)
+}
+
+// base64Reader . 每次读取的数据单独编码 用于 application/grpc-web-text 的流式响应
+type base64Reader struct {
+	reader  io.Reader
+	pending []byte
+}
+
+func (r *base64Reader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		size := len(p) / 4 * 3
+		if size == 0 {
+			size = 3
+		}
+		raw := make([]byte, size)
+		n, err := r.reader.Read(raw)
+		if n == 0 {
+			return 0, err
+		}
+		r.pending = make([]byte, base64.StdEncoding.EncodedLen(n))
+		base64.StdEncoding.Encode(r.pending, raw[:n])
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// grpcTrailers . gRPC 响应的 trailer 原样转发给客户端
+func grpcTrailers(header http.Header, res *http.Response) {
+	for key, values := range res.Trailer {
+		for _, value := range values {
+			header.Add(http.TrailerPrefix+key, value)
+		}
+	}
+}
+
+// grpcStatus . 网关自身的错误对应的 gRPC 状态码
+func grpcStatus(err error) int {
+	if statusErr, ok := err.(GRPCStatusError); ok {
+		return statusErr.Status
+	}
+	switch err {
+	case RequestCanceled:
+		return GRPCCanceled
+	case RequestTimeout, BackendTimeout:
+		return GRPCDeadlineExceeded
+	case BackendQPSExceeded:
+		return GRPCResourceExhausted
+	case APINotFound:
+		return GRPCUnimplemented
+	case TokenValidFailed, TokenEmpty, UserIDEmpty, DeviceTypeEmpty, DeviceInfoEmpty:
+		return GRPCUnauthenticated
+	}
+	return GRPCUnavailable
+}
+
+// grpcMessage . 按 gRPC 规范对 grpc-message 做百分号编码
+func grpcMessage(message string) string {
+	var buf bytes.Buffer
+	for i, l := 0, len(message); i < l; i++ {
+		if c := message[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// renderGRPCError . 网关与插件的错误以 trailers-only 响应返回, gRPC 客户端只识别 grpc-status
+// gRPC-Web 请求沿用请求的 Content-Type, 状态同样放在响应头中
+func (c *Context) renderGRPCError(err error) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	header.Set("Grpc-Status", strconv.Itoa(grpcStatus(err)))
+	header.Set("Grpc-Message", grpcMessage(err.Error()))
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
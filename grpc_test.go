@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// 解码多段各自补齐的 base64
+func decodeBase64Segments(t *testing.T, text string) []byte {
+	var buf bytes.Buffer
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '=')
+		if end == -1 {
+			end = len(text)
+		}
+		for end < len(text) && text[end] == '=' {
+			end++
+		}
+		b, err := base64.StdEncoding.DecodeString(text[:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(b)
+		text = text[end:]
+	}
+	return buf.Bytes()
+}
+
+func TestGRPC(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.URL.Path != "/echo.Echo/Say" || r.Header.Get("Te") != "trailers" ||
+			r.Header.Get("Content-Type") != "application/grpc+proto" || !bytes.Equal(body, grpcFrame(0, []byte("ping"))) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Write(grpcFrame(0, []byte("pong")))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "ok")
+	}), &http2.Server{}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(tokenPlugin{})
+	engine.AddCluster(&Cluster{Name: "echo"})
+	_, cluster := engine.Cluster("echo")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5, Transport: TransportSetting{HTTP2: true}})
+	engine.Route(RouteInfo{Method: "POST", URL: "/echo.Echo/Say", Handlers: []string{"token"}, NodeGroup: []Node{
+		{Cluster: "echo"},
+	}})
+	// 后端服务不可达
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	engine.AddCluster(&Cluster{Name: "dead"})
+	_, dead := engine.Cluster("dead")
+	dead.Add(&Backend{Addr: listener.Addr().String(), Schema: "http", HeartDisabled: true, Timeout: 5, Transport: TransportSetting{HTTP2: true}})
+	engine.Route(RouteInfo{Method: "POST", URL: "/echo.Echo/Dead", NodeGroup: []Node{{Cluster: "dead"}}})
+	engine.Route(RouteInfo{Method: "POST", URL: "/echo.Echo/Empty"})
+	server := httptest.NewServer(engine.Handler())
+	defer server.Close()
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	callPath := func(client *http.Client, path, contentType, token string, body []byte) (*http.Response, []byte) {
+		req, _ := http.NewRequest("POST", server.URL+path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-Token", token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+	call := func(client *http.Client, contentType, token string, body []byte) (*http.Response, []byte) {
+		return callPath(client, "/echo.Echo/Say", contentType, token, body)
+	}
+
+	// gRPC 通过 h2c 转发, 保留 trailer
+	res, data := call(h2cClient, "application/grpc+proto", "ok", grpcFrame(0, []byte("ping")))
+	if res.StatusCode != http.StatusOK || !bytes.Equal(data, grpcFrame(0, []byte("pong"))) {
+		t.Fatalf("unexpected response %d %q", res.StatusCode, data)
+	}
+	if res.Trailer.Get("Grpc-Status") != "0" || res.Trailer.Get("Grpc-Message") != "ok" {
+		t.Fatalf("trailers should be preserved, got %v", res.Trailer)
+	}
+	// 插件同样对 gRPC 生效, 拒绝时以 trailers-only 响应返回
+	trailersOnly := func(res *http.Response, data []byte, contentType, status string) {
+		if res.StatusCode != http.StatusOK || len(data) != 0 || res.Header.Get("Content-Type") != contentType ||
+			res.Header.Get("Grpc-Status") != status || res.Header.Get("Grpc-Message") == "" {
+			t.Fatalf("want trailers-only response with grpc-status %s, got %d %v %q", status, res.StatusCode, res.Header, data)
+		}
+	}
+	res, data = call(h2cClient, "application/grpc+proto", "bad", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc+proto", "16")
+	res, data = call(http.DefaultClient, "application/grpc-web+proto", "bad", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc-web+proto", "16")
+	res, data = callPath(h2cClient, "/echo.Echo/Missing", "application/grpc+proto", "ok", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc+proto", "12")
+	res, data = callPath(h2cClient, "/echo.Echo/Empty", "application/grpc+proto", "ok", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc+proto", "14")
+
+	// gRPC-Web 通过 HTTP/1.1 访问, trailer 作为最后一帧
+	trailer := func(data []byte) string {
+		frame := grpcFrame(0, []byte("pong"))
+		if !bytes.HasPrefix(data, frame) || len(data) < len(frame)+5 || data[len(frame)] != grpcWebTrailerFlag {
+			t.Fatalf("unexpected grpc-web body %q", data)
+		}
+		return string(data[len(frame)+5:])
+	}
+	res, data = call(http.DefaultClient, "application/grpc-web+proto", "ok", grpcFrame(0, []byte("ping")))
+	if res.ProtoMajor != 1 || res.Header.Get("Content-Type") != "application/grpc-web+proto" {
+		t.Fatalf("unexpected grpc-web response %s %v", res.Proto, res.Header)
+	}
+	if trailers := trailer(data); !strings.Contains(trailers, "grpc-status: 0\r\n") || !strings.Contains(trailers, "grpc-message: ok\r\n") {
+		t.Fatalf("unexpected trailers %q", trailers)
+	}
+	body := []byte(base64.StdEncoding.EncodeToString(grpcFrame(0, []byte("ping"))))
+	res, data = call(http.DefaultClient, "application/grpc-web-text+proto", "ok", body)
+	if res.Header.Get("Content-Type") != "application/grpc-web-text+proto" {
+		t.Fatalf("unexpected grpc-web-text response %v", res.Header)
+	}
+	if trailers := trailer(decodeBase64Segments(t, string(data))); !strings.Contains(trailers, "grpc-status: 0\r\n") {
+		t.Fatalf("unexpected trailers %q", trailers)
+	}
+
+	// 后端服务不可达
+	res, data = callPath(h2cClient, "/echo.Echo/Dead", "application/grpc+proto", "ok", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc+proto", "14")
+	res, data = callPath(http.DefaultClient, "/echo.Echo/Dead", "application/grpc-web+proto", "ok", grpcFrame(0, []byte("ping")))
+	trailersOnly(res, data, "application/grpc-web+proto", "14")
+}
+
+func TestGRPCStatus(t *testing.T) {
+	if grpcStatus(BackendTimeout) != GRPCDeadlineExceeded || grpcStatus(RequestCanceled) != GRPCCanceled || grpcStatus(ClusterNotFound) != GRPCUnavailable ||
+		grpcStatus(APINotFound) != GRPCUnimplemented || grpcStatus(TokenEmpty) != GRPCUnauthenticated || grpcStatus(GRPCStatusError{GRPCUnauthenticated, ClusterNotFound}) != GRPCUnauthenticated {
+		t.Fatal("unexpected grpc status")
+	}
+	if message := grpcMessage("100% 服务"); message != "100%25 %E6%9C%8D%E5%8A%A1" {
+		t.Fatalf("unexpected grpc message %q", message)
+	}
+}
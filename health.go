@@ -0,0 +1,296 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// HealthCheckHTTP . HTTP 检查
+	HealthCheckHTTP = "http"
+	// HealthCheckTCP . 只检查能否建立 TCP 连接
+	HealthCheckTCP = "tcp"
+
+	// DefaultHealthyThreshold . 默认连续成功次数 达到后上线
+	DefaultHealthyThreshold = 1
+	// DefaultUnhealthyThreshold . 默认连续失败次数 达到后下线
+	DefaultUnhealthyThreshold = DefaultMaxFail
+
+	// 保留的检查记录数
+	maxHealthRecords = 20
+	// 读取的响应体上限
+	maxHealthBody = 1 << 20
+)
+
+type (
+	// HealthCheck . 主动健康检查配置 检查地址为 HeartPath, 间隔为 HeartDuration
+	HealthCheck struct {
+		// 检查方式 http|tcp, 默认 http
+		Type string `json:"type"`
+		// 请求方法 默认 GET
+		Method string `json:"method"`
+		// 请求头
+		Headers map[string]string `json:"headers"`
+		// 期望的状态码 例如 200 | 200-299 | 2xx, 为空时为 200
+		ExpectedStatus []string `json:"expectedStatus"`
+		// 响应体需要匹配的正则
+		BodyRegex string `json:"bodyRegex"`
+		// 响应体 JSON路径 JSONValue 为空时只要求存在
+		JSONPath  string `json:"jsonPath"`
+		JSONValue string `json:"jsonValue"`
+		// 连续成功次数 达到后上线
+		HealthyThreshold uint64 `json:"healthyThreshold"`
+		// 连续失败次数 达到后下线
+		UnhealthyThreshold uint64 `json:"unhealthyThreshold"`
+		// 单次检查超时时间(毫秒) 为空时使用后端服务的超时时间
+		Timeout int64 `json:"timeout"`
+	}
+	// HealthRecord . 检查记录
+	HealthRecord struct {
+		Time    int64   `json:"time"`
+		Healthy bool    `json:"healthy"`
+		Latency float64 `json:"latency"`
+		Message string  `json:"message,omitempty"`
+	}
+	// HealthState . 检查状态与最近的检查记录
+	HealthState struct {
+		mtx           sync.Mutex
+		status        BackendStatus
+		lastHeartTime int64
+		successes     uint64
+		failures      uint64
+		records       []HealthRecord
+	}
+	// 状态码范围
+	statusRange struct {
+		min int
+		max int
+	}
+	// 解析后的检查规则
+	healthRule struct {
+		status []statusRange
+		body   *regexp.Regexp
+	}
+)
+
+// 设置默认值
+func (check HealthCheck) getDefaultSetting() HealthCheck {
+	if check.Type == "" {
+		check.Type = HealthCheckHTTP
+	}
+	if check.Method == "" {
+		check.Method = "GET"
+	}
+	if check.HealthyThreshold < 1 {
+		check.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if check.UnhealthyThreshold < 1 {
+		check.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	return check
+}
+
+// 解析状态码 200 | 200-299 | 2xx
+func parseStatusRange(expected string) (statusRange, bool) {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if len(expected) == 3 && strings.HasSuffix(expected, "xx") && expected[0] >= '1' && expected[0] <= '5' {
+		base := int(expected[0]-'0') * 100
+		return statusRange{base, base + 99}, true
+	}
+	parts := strings.SplitN(expected, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return statusRange{}, false
+	}
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || max < min {
+			return statusRange{}, false
+		}
+	}
+	return statusRange{min, max}, true
+}
+
+// rule . 解析检查规则 配置错误时返回 HealthCheckNotValid
+func (check HealthCheck) rule() (*healthRule, error) {
+	switch check.Type {
+	case "", HealthCheckHTTP, HealthCheckTCP:
+	default:
+		return nil, HealthCheckNotValid
+	}
+	rule := &healthRule{}
+	for i, l := 0, len(check.ExpectedStatus); i < l; i++ {
+		status, ok := parseStatusRange(check.ExpectedStatus[i])
+		if !ok {
+			return nil, HealthCheckNotValid
+		}
+		rule.status = append(rule.status, status)
+	}
+	if len(rule.status) == 0 {
+		rule.status = []statusRange{{http.StatusOK, http.StatusOK}}
+	}
+	if check.BodyRegex != "" {
+		body, err := regexp.Compile(check.BodyRegex)
+		if err != nil {
+			return nil, HealthCheckNotValid
+		}
+		rule.body = body
+	}
+	return rule, nil
+}
+
+func (rule *healthRule) expected(status int) bool {
+	for i, l := 0, len(rule.status); i < l; i++ {
+		if status >= rule.status[i].min && status <= rule.status[i].max {
+			return true
+		}
+	}
+	return false
+}
+
+// probe . 执行一次检查 健康时返回 nil
+func (backend *Backend) probe() error {
+	check := backend.HealthCheck
+	timeout := time.Duration(backend.Timeout) * time.Second
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Millisecond
+	}
+	if check.Type == HealthCheckTCP {
+		conn, err := net.DialTimeout("tcp", backend.Addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	req, err := http.NewRequest(check.Method, fmt.Sprintf("%s://%s%s", backend.Schema, backend.Addr, backend.HeartPath), nil)
+	if err != nil {
+		return err
+	}
+	for key, val := range check.Headers {
+		req.Header.Set(key, val)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := backend.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxHealthBody))
+	if err != nil {
+		return err
+	}
+	return backend.healthRule.verify(check, backend.HeartResponseBody, res.StatusCode, body)
+}
+
+// verify . 校验状态码与响应体
+func (rule *healthRule) verify(check HealthCheck, heartResponseBody string, status int, body []byte) error {
+	if !rule.expected(status) {
+		return fmt.Errorf("unexpected status %d", status)
+	}
+	// 兼容原有的响应体完全匹配
+	if heartResponseBody != "" && string(body) != heartResponseBody {
+		return fmt.Errorf("unexpected body")
+	}
+	if rule.body != nil && !rule.body.Match(body) {
+		return fmt.Errorf("body does not match %s", rule.body.String())
+	}
+	if check.JSONPath != "" {
+		data, err := decodeJSON(body)
+		if err != nil {
+			return fmt.Errorf("body is not json")
+		}
+		val, ok := jsonPath(data, check.JSONPath)
+		if !ok {
+			return fmt.Errorf("%s not found", check.JSONPath)
+		}
+		if check.JSONValue != "" && jsonString(val) != check.JSONValue {
+			return fmt.Errorf("%s is %s", check.JSONPath, jsonString(val))
+		}
+	}
+	return nil
+}
+
+// check . 执行检查并记录结果
+func (backend *Backend) check() {
+	now := time.Now()
+	err := backend.probe()
+	backend.Health.record(backend.HealthCheck, now, time.Since(now), err)
+}
+
+// healthcheck . 按 HeartDuration 定时检查, 调用 close 后停止
+func (backend *Backend) healthcheck() {
+	ticker := time.NewTicker(time.Second * time.Duration(backend.HeartDuration))
+	go func(stop chan struct{}) {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				backend.check()
+			}
+		}
+	}(backend.stop)
+}
+
+// record . 记录检查结果 连续成功或失败达到阈值时切换状态
+func (state *HealthState) record(check HealthCheck, now time.Time, elapsed time.Duration, err error) {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	state.lastHeartTime = now.Unix()
+	record := HealthRecord{
+		Time:    now.Unix(),
+		Healthy: err == nil,
+		Latency: float64(elapsed) / float64(time.Millisecond),
+	}
+	if err != nil {
+		record.Message = err.Error()
+		state.successes = 0
+		state.failures++
+		if state.failures >= check.UnhealthyThreshold {
+			state.status = BackendDown
+		}
+	} else {
+		state.failures = 0
+		state.successes++
+		if state.successes >= check.HealthyThreshold {
+			state.status = BackendUp
+		}
+	}
+	state.records = append(state.records, record)
+	if len(state.records) > maxHealthRecords {
+		state.records = state.records[len(state.records)-maxHealthRecords:]
+	}
+}
+
+// snapshot . 当前状态与最后检测时间
+func (state *HealthState) snapshot() (BackendStatus, int64) {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	return state.status, state.lastHeartTime
+}
+
+// MarshalJSON . 输出最近的检查记录
+func (state *HealthState) MarshalJSON() ([]byte, error) {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	records := make([]HealthRecord, len(state.records))
+	copy(records, state.records)
+	return json.Marshal(H{
+		"successes": state.successes,
+		"failures":  state.failures,
+		"records":   records,
+	})
+}
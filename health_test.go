@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck_Rule(t *testing.T) {
+	rule, err := HealthCheck{ExpectedStatus: []string{"204", "300-302", "4xx"}}.rule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for status, want := range map[int]bool{200: false, 204: true, 301: true, 303: false, 404: true, 500: false} {
+		if rule.expected(status) != want {
+			t.Fatalf("status %d want %v", status, want)
+		}
+	}
+	for _, check := range []HealthCheck{
+		{Type: "udp"},
+		{ExpectedStatus: []string{"abc"}},
+		{ExpectedStatus: []string{"299-200"}},
+		{BodyRegex: "("},
+	} {
+		if _, err := check.rule(); err != HealthCheckNotValid {
+			t.Fatalf("%+v want HealthCheckNotValid, got %v", check, err)
+		}
+	}
+}
+
+func TestBackend_ProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" && r.Header.Get("X-Health") != "gateway" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"UP","db":{"ok":true}}`))
+	}))
+	defer server.Close()
+	probe := func(check HealthCheck) error {
+		backend := &Backend{Addr: strings.TrimPrefix(server.URL, "http://"), Schema: "http", HeartPath: "/health", HeartDisabled: true, HealthCheck: check}
+		backend.getDefaultSetting()
+		defer backend.close()
+		return backend.probe()
+	}
+	headers := map[string]string{"X-Health": "gateway"}
+	cases := []struct {
+		check   HealthCheck
+		healthy bool
+	}{
+		{HealthCheck{}, false},
+		{HealthCheck{ExpectedStatus: []string{"2xx"}}, false},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"2xx"}}, true},
+		{HealthCheck{Method: "HEAD", ExpectedStatus: []string{"202"}}, true},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"200-299"}, BodyRegex: `"status":\s*"UP"`}, true},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"200-299"}, BodyRegex: `DOWN`}, false},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"2xx"}, JSONPath: "db.ok", JSONValue: "true"}, true},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"2xx"}, JSONPath: "status", JSONValue: "DOWN"}, false},
+		{HealthCheck{Headers: headers, ExpectedStatus: []string{"2xx"}, JSONPath: "cache"}, false},
+	}
+	for i, c := range cases {
+		if err := probe(c.check); (err == nil) != c.healthy {
+			t.Fatalf("case %d want healthy %v, got %v", i, c.healthy, err)
+		}
+	}
+}
+
+func TestBackend_ProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	backend := &Backend{Addr: addr, HeartDisabled: true, HealthCheck: HealthCheck{Type: HealthCheckTCP, Timeout: 500}}
+	backend.getDefaultSetting()
+	if err := backend.probe(); err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	if err := backend.probe(); err == nil {
+		t.Fatal("closed port should be unhealthy")
+	}
+}
+
+func TestHealthState_Threshold(t *testing.T) {
+	check := HealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 3}.getDefaultSetting()
+	state := &HealthState{status: BackendDown}
+	failed := errors.New("failed")
+	steps := []struct {
+		err error
+		up  bool
+	}{
+		{nil, false},
+		{nil, true},
+		{failed, true},
+		{failed, true},
+		{nil, true},
+		{failed, true},
+		{failed, true},
+		{failed, false},
+		{nil, false},
+		{nil, true},
+	}
+	for i, step := range steps {
+		state.record(check, time.Now(), time.Millisecond, step.err)
+		if status, _ := state.snapshot(); (status == BackendUp) != step.up {
+			t.Fatalf("step %d want up %v", i, step.up)
+		}
+	}
+	for i := 0; i < maxHealthRecords; i++ {
+		state.record(check, time.Now(), time.Millisecond, nil)
+	}
+	if len(state.records) != maxHealthRecords {
+		t.Fatalf("want %d records, got %d", maxHealthRecords, len(state.records))
+	}
+}
+
+func TestCluster_HealthCheck(t *testing.T) {
+	healthy := make(chan bool, 1)
+	healthy <- true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := <-healthy
+		healthy <- ok
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	cluster := &Cluster{Name: "test", LoadBalance: BalanceRoundRobin}
+	backend := &Backend{
+		Addr:          strings.TrimPrefix(server.URL, "http://"),
+		Schema:        "http",
+		HeartPath:     "/health",
+		HeartDuration: 1,
+		HealthCheck:   HealthCheck{UnhealthyThreshold: 1},
+	}
+	if err := cluster.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Remove(backend.Addr)
+	wait := func(up bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for (backend.status() == BackendUp) != up {
+			if time.Now().After(deadline) {
+				t.Fatalf("backend should be up %v", up)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	wait(true)
+	<-healthy
+	healthy <- false
+	wait(false)
+	if _, err := cluster.Balance(nil); err == nil {
+		t.Fatal("unhealthy backend should not be balanced")
+	}
+	if err := cluster.Add(&Backend{Addr: "invalid", HealthCheck: HealthCheck{BodyRegex: "("}}); err != HealthCheckNotValid {
+		t.Fatalf("want HealthCheckNotValid, got %v", err)
+	}
+}
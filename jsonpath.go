@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// decodeJSON . 解析 JSON, 数字保留原始格式
+func decodeJSON(data []byte) (val interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&val)
+	return val, err
+}
+
+// splitJSONPath . data.items[0].id => [data items 0 id]
+func splitJSONPath(path string) []string {
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+	segments := strings.Split(path, ".")
+	keys := make([]string, 0, len(segments))
+	for i, l := 0, len(segments); i < l; i++ {
+		if segments[i] != "" {
+			keys = append(keys, segments[i])
+		}
+	}
+	return keys
+}
+
+// jsonPath . 按路径读取 JSON 中的值, 路径为空时返回整个 JSON
+func jsonPath(data interface{}, path string) (interface{}, bool) {
+	keys := splitJSONPath(path)
+	for i, l := 0, len(keys); i < l; i++ {
+		switch val := data.(type) {
+		case map[string]interface{}:
+			next, ok := val[keys[i]]
+			if !ok {
+				return nil, false
+			}
+			data = next
+		case []interface{}:
+			index, err := strconv.Atoi(keys[i])
+			if err != nil || index < 0 || index >= len(val) {
+				return nil, false
+			}
+			data = val[index]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// jsonString . JSON 值转为参数值, 对象与数组保留 JSON 格式
+func jsonString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(val)
+	return string(b)
+}
+
+// deleteJSONPath . 按路径删除对象中的字段
+func deleteJSONPath(data interface{}, path string) {
+	keys := splitJSONPath(path)
+	if len(keys) == 0 {
+		return
+	}
+	parent, ok := jsonPath(data, strings.Join(keys[:len(keys)-1], "."))
+	if !ok {
+		return
+	}
+	if obj, ok := parent.(map[string]interface{}); ok {
+		delete(obj, keys[len(keys)-1])
+	}
+}
+
+// setJSONPath . 按路径写入值, 不存在的对象会自动创建 例如 user.address.city
+// copyJSON . 深复制 JSON 对象与数组
+func copyJSON(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[key] = copyJSON(item)
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = copyJSON(item)
+		}
+		return list
+	}
+	return val
+}
+
+func setJSONPath(data map[string]interface{}, path string, val interface{}) {
+	keys := splitJSONPath(path)
+	if len(keys) == 0 {
+		return
+	}
+	for i, l := 0, len(keys)-1; i < l; i++ {
+		next, ok := data[keys[i]].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			data[keys[i]] = next
+		}
+		data = next
+	}
+	data[keys[len(keys)-1]] = val
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	data, err := decodeJSON([]byte(`{"data":{"orgId":12345678901234567,"items":[{"id":"a"},{"id":"b"}],"ok":true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, expect := range map[string]string{
+		"data.orgId":       "12345678901234567",
+		"data.items[1].id": "b",
+		"data.items.0.id":  "a",
+		"data.ok":          "true",
+		"data.items[2].id": "",
+		"data.missing":     "",
+	} {
+		val, _ := jsonPath(data, path)
+		if jsonString(val) != expect {
+			t.Fatalf("%s expect %s got %s", path, expect, jsonString(val))
+		}
+	}
+}
+
+func TestSetJSONPath(t *testing.T) {
+	data := make(map[string]interface{})
+	setJSONPath(data, "user.address.city", "hz")
+	setJSONPath(data, "user.id", json.Number("1"))
+	setJSONPath(data, "name", "n")
+	if b, _ := json.Marshal(data); string(b) != `{"name":"n","user":{"address":{"city":"hz"},"id":1}}` {
+		t.Fatalf("unexpected json %s", b)
+	}
+}
+
+func TestNode_JSONBody(t *testing.T) {
+	var (
+		contentType string
+		body        []byte
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.AddCluster(&Cluster{Name: "json"})
+	_, cluster := engine.Cluster("json")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	node := Node{Cluster: "json", Rewrite: "/", ParamGroup: []Param{
+		{Attr: "user.address.city", From: ParamFromJSON, To: ParamFromJSON, ToName: "profile.city", Required: true},
+		{Attr: "user.tags", From: ParamFromJSON, To: ParamFromJSON, ToName: "profile.tags"},
+		{Attr: "user.id", From: ParamFromJSON, To: ParamFromQuery, ToName: "id"},
+		{Attr: "X-Source", From: ParamFromHeader, To: ParamFromJSON, ToName: "source"},
+	}}
+	ctx := engine.allocateContext()
+	ctx.reset()
+	ctx.Request = httptest.NewRequest("POST", "/", strings.NewReader(`{"user":{"id":10,"address":{"city":"hz"},"tags":["a","b"]}}`))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Request.Header.Set("X-Source", "app")
+	ctx.routeInfo = RouteInfo{Method: "POST"}
+	ctx.collect(node.Do(ctx))
+	if ctx.responses[0].Error != nil {
+		t.Fatal(ctx.responses[0].Error)
+	}
+	if !strings.HasPrefix(contentType, "application/json") {
+		t.Fatalf("unexpected content type %s", contentType)
+	}
+	if string(body) != `{"profile":{"city":"hz","tags":["a","b"]},"source":"app"}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+	if !strings.HasSuffix(ctx.ExecInfoGroup[0].BackendURI, "?id=10") {
+		t.Fatalf("unexpected uri %s", ctx.ExecInfoGroup[0].BackendURI)
+	}
+
+	// 写入复制的对象下不能修改请求体
+	node.ParamGroup = []Param{
+		{Attr: "user", From: ParamFromJSON, To: ParamFromJSON, ToName: "profile"},
+		{Attr: "X-Source", From: ParamFromHeader, To: ParamFromJSON, ToName: "profile.address.source"},
+	}
+	ctx.collect(node.Do(ctx))
+	if string(body) != `{"profile":{"address":{"city":"hz","source":"app"},"id":10,"tags":["a","b"]}}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+	if b, _ := json.Marshal(ctx.jsonBody); string(b) != `{"user":{"address":{"city":"hz"},"id":10,"tags":["a","b"]}}` {
+		t.Fatalf("request body should not be modified, got %s", b)
+	}
+}
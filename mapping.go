@@ -0,0 +1,76 @@
+package gateway
+
+import "encoding/json"
+
+type (
+	// ResponseField . 选取的字段
+	ResponseField struct {
+		// 后端服务响应中的 JSON路径 例如 data.user.name
+		Path string `json:"path"`
+		// 输出的名称 支持 JSON路径, 为空时使用 Path 的最后一段
+		Name string `json:"name"`
+	}
+	// ResponseMapping . 节点的响应映射 先选取字段, 再删除字段
+	ResponseMapping struct {
+		// 选取的字段 为空时保留全部
+		Fields []ResponseField `json:"fields"`
+		// 删除的字段 JSON路径
+		Drop []string `json:"drop"`
+		// 合并到根对象 而不是放在节点的 Attr 下
+		Flatten bool `json:"flatten"`
+	}
+)
+
+// apply . 按配置处理后端服务的响应
+func (mapping *ResponseMapping) apply(data interface{}) interface{} {
+	if len(mapping.Fields) > 0 {
+		selected := make(map[string]interface{})
+		for i, l := 0, len(mapping.Fields); i < l; i++ {
+			field := mapping.Fields[i]
+			val, ok := jsonPath(data, field.Path)
+			if !ok {
+				continue
+			}
+			name := field.Name
+			if name == "" {
+				keys := splitJSONPath(field.Path)
+				if len(keys) == 0 {
+					continue
+				}
+				name = keys[len(keys)-1]
+			}
+			setJSONPath(selected, name, val)
+		}
+		data = selected
+	}
+	for i, l := 0, len(mapping.Drop); i < l; i++ {
+		deleteJSONPath(data, mapping.Drop[i])
+	}
+	return data
+}
+
+// value . 节点的响应 无法解析为 JSON 时返回字符串
+func (response combineResponse) value() interface{} {
+	if response.mapping == nil {
+		if response.encoded {
+			if data, err := decodeJSON(response.Response); err == nil {
+				return data
+			}
+		}
+		res := H{}
+		if err := json.Unmarshal(response.Response, &res); err != nil {
+			return string(response.Response)
+		}
+		return res
+	}
+	data, err := decodeJSON(response.Response)
+	if err != nil {
+		return string(response.Response)
+	}
+	return response.mapping.apply(data)
+}
+
+// flatten . 是否合并到根对象
+func (response combineResponse) flatten() bool {
+	return response.mapping != nil && response.mapping.Flatten
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseMapping(t *testing.T) {
+	data, _ := decodeJSON([]byte(`{"code":0,"data":{"user":{"id":1,"name":"u","password":"p"},"orgs":[{"id":2}]}}`))
+	mapping := &ResponseMapping{
+		Fields: []ResponseField{
+			{Path: "data.user"},
+			{Path: "data.orgs[0].id", Name: "org.id"},
+			{Path: "data.missing"},
+		},
+		Drop: []string{"user.password"},
+	}
+	if b, _ := json.Marshal(mapping.apply(data)); string(b) != `{"org":{"id":2},"user":{"id":1,"name":"u"}}` {
+		t.Fatalf("unexpected mapping %s", b)
+	}
+	data, _ = decodeJSON([]byte(`{"code":0,"data":{}}`))
+	if b, _ := json.Marshal((&ResponseMapping{Drop: []string{"code"}}).apply(data)); string(b) != `{"data":{}}` {
+		t.Fatalf("unexpected drop %s", b)
+	}
+}
+
+func TestRender_Mapping(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{"id":"` + r.URL.Path[1:] + `","extra":"x"}}`))
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "bff"})
+	_, cluster := engine.Cluster("bff")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	engine.Route(RouteInfo{Method: "GET", URL: "/bff", NodeGroup: []Node{
+		{Attr: "user", Cluster: "bff", Rewrite: "/u", Response: &ResponseMapping{
+			Fields:  []ResponseField{{Path: "data.id", Name: "userId"}},
+			Flatten: true,
+		}},
+		{Attr: "org", Cluster: "bff", Rewrite: "/o", Response: &ResponseMapping{Drop: []string{"code", "data.extra"}}},
+		{Attr: "raw", Cluster: "bff", Rewrite: "/r"},
+	}})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/bff", nil))
+	expect := `{"org":{"data":{"id":"o"}},"raw":{"code":0,"data":{"extra":"x","id":"r"}},"userId":"u"}`
+	if body := strings.TrimSpace(w.Body.String()); body != expect {
+		t.Fatalf("unexpected response %s", body)
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMetricsWindowInSeconds . 默认统计窗口
+const DefaultMetricsWindowInSeconds = 10
+
+type (
+	// 每秒一个桶
+	metricsBucket struct {
+		second   int64
+		started  uint64
+		finished uint64
+		total    time.Duration
+		max      time.Duration
+	}
+	// slidingWindow . 滑动窗口统计 用于限流与QPS/响应时间
+	slidingWindow struct {
+		mtx     sync.Mutex
+		buckets []metricsBucket
+	}
+	// windowStats . 窗口内的统计结果
+	windowStats struct {
+		QPS         uint64
+		AverageTime uint64
+		MaxTime     uint64
+	}
+)
+
+func newSlidingWindow(seconds int) *slidingWindow {
+	if seconds < 1 {
+		seconds = DefaultMetricsWindowInSeconds
+	}
+	return &slidingWindow{buckets: make([]metricsBucket, seconds+1)}
+}
+
+// 获取当前秒对应的桶, 过期的桶会被重置, 调用方需持有锁
+func (window *slidingWindow) bucket(second int64) *metricsBucket {
+	bucket := &window.buckets[second%int64(len(window.buckets))]
+	if bucket.second != second {
+		*bucket = metricsBucket{second: second}
+	}
+	return bucket
+}
+
+// take . 按滑动窗口估算当前QPS, 未超过 limit 时占用一个名额
+// 估算值 = 上一秒请求数 * 上一秒在窗口内的比例 + 当前秒请求数
+func (window *slidingWindow) take(now time.Time, limit uint64) bool {
+	window.mtx.Lock()
+	defer window.mtx.Unlock()
+	second := now.Unix()
+	current := window.bucket(second)
+	var previous uint64
+	if bucket := window.buckets[(second-1)%int64(len(window.buckets))]; bucket.second == second-1 {
+		previous = bucket.started
+	}
+	elapsed := float64(now.UnixNano()%int64(time.Second)) / float64(time.Second)
+	if float64(previous)*(1-elapsed)+float64(current.started) >= float64(limit) {
+		return false
+	}
+	current.started++
+	return true
+}
+
+// record . 记录一次完成的请求
+func (window *slidingWindow) record(now time.Time, elapsed time.Duration) {
+	window.mtx.Lock()
+	defer window.mtx.Unlock()
+	bucket := window.bucket(now.Unix())
+	bucket.finished++
+	bucket.total += elapsed
+	if elapsed > bucket.max {
+		bucket.max = elapsed
+	}
+}
+
+// stats . 最近完整的若干秒内的QPS, 平均与最大响应时间(毫秒)
+func (window *slidingWindow) stats(now time.Time) (stats windowStats) {
+	window.mtx.Lock()
+	defer window.mtx.Unlock()
+	var (
+		finished uint64
+		total    time.Duration
+		max      time.Duration
+	)
+	seconds := int64(len(window.buckets) - 1)
+	second := now.Unix()
+	for i := int64(1); i <= seconds; i++ {
+		bucket := window.buckets[(second-i)%int64(len(window.buckets))]
+		if bucket.second != second-i {
+			continue
+		}
+		finished += bucket.finished
+		total += bucket.total
+		if bucket.max > max {
+			max = bucket.max
+		}
+	}
+	stats.QPS = finished / uint64(seconds)
+	if finished > 0 {
+		stats.AverageTime = uint64(total / time.Duration(finished) / time.Millisecond)
+	}
+	stats.MaxTime = uint64(max / time.Millisecond)
+	return stats
+}
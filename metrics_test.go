@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	window := newSlidingWindow(10)
+	base := time.Unix(1000, 0)
+	for i := 0; i < 20; i++ {
+		window.record(base.Add(time.Duration(i%2)*time.Second), time.Duration(i+1)*time.Millisecond)
+	}
+	stats := window.stats(base.Add(2 * time.Second))
+	if stats.QPS != 2 || stats.AverageTime != 10 || stats.MaxTime != 20 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// 超出窗口后清零
+	if stats := window.stats(base.Add(30 * time.Second)); stats.QPS != 0 || stats.MaxTime != 0 {
+		t.Fatalf("stats should expire, got %+v", stats)
+	}
+	// 上一秒的请求按比例计入
+	for i := 0; i < 10; i++ {
+		if !window.take(base.Add(40*time.Second), 10) {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	if window.take(base.Add(40*time.Second), 10) {
+		t.Fatal("request over limit should be rejected")
+	}
+	// 10*0.9 + 0 < 10, 10*0.9 + 1 >= 10
+	if !window.take(base.Add(41*time.Second+100*time.Millisecond), 10) ||
+		window.take(base.Add(41*time.Second+100*time.Millisecond), 10) {
+		t.Fatal("previous second should still count at the start of the next second")
+	}
+	if !window.take(base.Add(41*time.Second+500*time.Millisecond), 10) {
+		t.Fatal("half of previous second should allow new requests")
+	}
+}
+
+func TestCluster_BalanceMaxQPS(t *testing.T) {
+	cluster := &Cluster{Name: "test", LoadBalance: BalanceRoundRobin}
+	for _, addr := range []string{"a", "b"} {
+		backend := &Backend{Addr: addr, HeartDisabled: true, MaxQPS: 1}
+		backend.getDefaultSetting()
+		cluster.backends = append(cluster.backends, backend)
+	}
+	picked := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		backend, err := cluster.Balance(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked[backend.Addr] = true
+	}
+	if !picked["a"] || !picked["b"] {
+		t.Fatalf("requests should spill to other backends, got %v", picked)
+	}
+	if _, err := cluster.Balance(nil); err != BackendQPSExceeded {
+		t.Fatalf("want BackendQPSExceeded, got %v", err)
+	}
+}
+
+// 输出状态时不能与请求中的原子更新产生竞争
+func TestBackend_MarshalJSONRace(t *testing.T) {
+	backend := (&Backend{Addr: "a", HeartDisabled: true}).getDefaultSetting()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			atomic.AddUint64(&backend.Waiting, 1)
+			atomic.AddInt64(&backend.Connections, 1)
+			backend.observe(time.Millisecond, false)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := json.Marshal(backend); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	var snapshot struct {
+		Waiting     uint64 `json:"waiting"`
+		Connections int64  `json:"connections"`
+	}
+	b, _ := json.Marshal(backend)
+	if err := json.Unmarshal(b, &snapshot); err != nil || snapshot.Waiting != 1000 || snapshot.Connections != 1000 {
+		t.Fatalf("unexpected snapshot %s", b)
+	}
+}
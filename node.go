@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"goodsogood/errors"
 	"io/ioutil"
@@ -9,9 +10,10 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
 // ParamFrom .
@@ -24,6 +26,13 @@ const (
 	ParamFromQuery
 	// ParamFromBody .
 	ParamFromBody
+	// ParamFromPath . 路径参数 例如 /users/:id
+	ParamFromPath
+	// ParamFromNode . 依赖节点的返回值 Attr 格式为 节点名.JSON路径 例如 user.data.orgId
+	ParamFromNode
+	// ParamFromJSON . JSON 格式的请求体 Attr 为 JSON路径 例如 user.address.city
+	// 作为目标时按 ToName 生成嵌套的 JSON 对象
+	ParamFromJSON
 )
 
 func (paramFrom ParamFrom) String() string {
@@ -34,6 +43,12 @@ func (paramFrom ParamFrom) String() string {
 		return "Query"
 	case ParamFromBody:
 		return "Body"
+	case ParamFromPath:
+		return "Path"
+	case ParamFromNode:
+		return "Node"
+	case ParamFromJSON:
+		return "JSON"
 	}
 	return "Unknown"
 }
@@ -55,12 +70,37 @@ type (
 		Cluster    string  `json:"cluster"`
 		Rewrite    string  `json:"rewrite"`
 		ParamGroup []Param `json:"paramGroup"`
+		// 依赖的节点 依赖的节点执行完成后才会执行
+		DependsOn []string `json:"dependsOn,omitempty"`
+		// 超时时间(毫秒) 0 为使用后端服务的超时时间
+		Timeout int64 `json:"timeout"`
+		// 必要节点 合并多个节点时, 必要节点失败则整个请求失败
+		Required bool `json:"required"`
+		// 可选节点失败时的默认值 JSON 格式 例如 null | {}, 失败原因放在 _errors 中
+		// 为空时在 Attr 下返回错误信息
+		Fallback string `json:"fallback"`
+		// 响应映射 为空时原样返回
+		Response *ResponseMapping `json:"response,omitempty"`
+		// 重试策略 为空时使用路由的重试策略
+		Retry *RetryPolicy `json:"retry,omitempty"`
+		// gRPC 方法 package.Service/Method, 设置后参数按 ToName 转为 protobuf 消息
+		// 调用后端服务的 unary 方法, 响应转为 JSON. 需要先注册对应的描述集
+		GRPCMethod string `json:"grpcMethod"`
+		// thrift 方法 Service.method, 设置后参数按 ToName 转为方法参数
+		// 通过连接池调用 thrift 后端服务, 返回值转为 JSON. 需要先注册对应的 IDL
+		ThriftMethod string `json:"thriftMethod"`
 	}
 	// ParseParam .
 	ParseParam struct {
 		header map[string]string
 		query  url.Values
 		body   url.Values
+		path   map[string]string
+		json   map[string]interface{}
+		// gRPC 请求 节点设置了 GRPCMethod 时使用
+		grpc *grpcCall
+		// thrift 请求 节点设置了 ThriftMethod 时使用
+		thrift *thriftCall
 	}
 )
 
@@ -70,11 +110,15 @@ func (node Node) parse(ctx *Context) (parseParam ParseParam, err error) {
 		header: make(map[string]string),
 		query:  make(url.Values),
 		body:   make(url.Values),
+		path:   make(map[string]string),
+		json:   make(map[string]interface{}),
 	}
 	for i, l := 0, len(node.ParamGroup); i < l; i++ {
 		param := node.ParamGroup[i]
 		var (
 			val string
+			// JSON 来源的原始值 目标为 JSON 时保留类型
+			raw interface{}
 		)
 		switch param.From {
 		case ParamFromHeader:
@@ -83,6 +127,14 @@ func (node Node) parse(ctx *Context) (parseParam ParseParam, err error) {
 			val = ctx.Request.URL.Query().Get(param.Attr)
 		case ParamFromBody:
 			val = ctx.PostForm(param.Attr)
+		case ParamFromPath:
+			val = ctx.Param(param.Attr)
+		case ParamFromNode:
+			raw = ctx.nodeValue(param.Attr)
+			val = jsonString(raw)
+		case ParamFromJSON:
+			raw = ctx.jsonValue(param.Attr)
+			val = jsonString(raw)
 		}
 		if len(val) < 1 && param.Required {
 			return parseParam, errors.New(-9004, fmt.Sprintf("Attr %s Is Required", param.Attr))
@@ -90,12 +142,12 @@ func (node Node) parse(ctx *Context) (parseParam ParseParam, err error) {
 		if param.rule != nil && !param.rule.MatchString(val) {
 			return parseParam, errors.New(-9004, fmt.Sprintf("Attr %s Is't Validation", param.Attr))
 		}
-		parseParam = parseParam.set(param, val)
+		parseParam = parseParam.set(param, val, raw)
 	}
 	return parseParam, nil
 }
 
-func (parseParam ParseParam) set(param Param, val string) ParseParam {
+func (parseParam ParseParam) set(param Param, val string, raw interface{}) ParseParam {
 	switch param.To {
 	case ParamFromHeader:
 		parseParam.header[param.ToName] = val
@@ -103,82 +155,225 @@ func (parseParam ParseParam) set(param Param, val string) ParseParam {
 		parseParam.query.Add(param.ToName, val)
 	case ParamFromBody:
 		parseParam.body.Add(param.ToName, val)
+	case ParamFromPath:
+		parseParam.path[param.ToName] = val
+	case ParamFromJSON:
+		if raw == nil {
+			raw = val
+		}
+		// 请求体与节点结果由多个节点共享, 复制后再写入避免修改原数据
+		setJSONPath(parseParam.json, param.ToName, copyJSON(raw))
 	}
 	return parseParam
 }
 
+// rewrite . 替换 Rewrite 中的 {name} 占位符, 优先使用参数映射的值, 其次是路由的路径参数
+func (node Node) rewrite(ctx *Context, path map[string]string) string {
+	rewrite := node.Rewrite
+	if strings.IndexByte(rewrite, '{') == -1 {
+		return rewrite
+	}
+	var buffer bytes.Buffer
+	for {
+		start := strings.IndexByte(rewrite, '{')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(rewrite[start:], '}')
+		if end == -1 {
+			break
+		}
+		end += start
+		name := rewrite[start+1 : end]
+		val, ok := path[name]
+		if !ok {
+			val = ctx.Param(name)
+		}
+		buffer.WriteString(rewrite[:start])
+		buffer.WriteString(escapePath(val))
+		rewrite = rewrite[end+1:]
+	}
+	buffer.WriteString(rewrite)
+	return buffer.String()
+}
+
 var step = -1
 
-// Do . 执行
-func (node Node) Do(ctx *Context, wg *sync.WaitGroup) {
-	if wg != nil {
-		defer wg.Done()
-	}
+// Do . 执行 结果只写入返回值, 可以并发调用
+func (node Node) Do(ctx *Context) (response combineResponse) {
+	response = node.result(nil)
 	has, cluster := ctx.engine.clusters.Get(node.Cluster)
-	response := combineResponse{
-		Attr: node.Attr,
-	}
 	if !has {
 		response.Error = ClusterNotFound
-		ctx.responses = append(ctx.responses, response)
-		return
-	}
-	backend, err := cluster.Balance()
-	if err != nil {
-		response.Error = err
-		ctx.responses = append(ctx.responses, response)
 		return
 	}
 	parseParam, err := node.parse(ctx)
 	if err != nil {
 		response.Error = err
-		ctx.responses = append(ctx.responses, response)
 		return
 	}
+	switch {
+	case node.GRPCMethod != "":
+		if parseParam.grpc, err = node.grpcRequest(ctx, parseParam); err != nil {
+			response.Error = err
+			return
+		}
+	case node.ThriftMethod != "":
+		if parseParam.thrift, err = node.thriftRequest(ctx, parseParam); err != nil {
+			response.Error = err
+			return
+		}
+	}
+	policy := node.retryPolicy(ctx.routeInfo)
+	attempts := policy.attempts(ctx.routeInfo.Method)
+	tried := make([]string, 0, attempts)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if ctx.Err() != nil {
+			response.Error = ctx.abortError()
+			break
+		}
+		// 重试时排除已经请求过的后端服务
+		backend, err := cluster.Balance(ctx, tried...)
+		if err != nil {
+			if attempt == 1 {
+				response.Error = err
+			}
+			break
+		}
+		tried = append(tried, backend.Addr)
+		status, err := node.call(ctx, cluster, backend, parseParam, attempt, &response)
+		if attempt == attempts || !policy.retryable(status, err) {
+			break
+		}
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	return
+}
+
+// result . 节点的执行结果
+func (node Node) result(err error) combineResponse {
+	return combineResponse{
+		Attr:     node.Attr,
+		Error:    err,
+		mapping:  node.Response,
+		required: node.Required,
+		fallback: node.Fallback,
+	}
+}
+
+// call . 请求一次后端服务, 结果写入 response
+func (node Node) call(ctx *Context, cluster *Cluster, backend *Backend, parseParam ParseParam, attempt int, response *combineResponse) (status int, err error) {
+	if parseParam.thrift != nil {
+		return node.callThrift(ctx, cluster, backend, parseParam, attempt, response)
+	}
 	uri := uriEncode(backend.Schema,
 		"://",
 		backend.Addr,
-		node.Rewrite,
+		node.rewrite(ctx, parseParam.path),
 		"?",
 		parseParam.query.Encode(),
 	)
+	method := ctx.routeInfo.Method
+	if parseParam.grpc != nil {
+		uri, method = backend.Schema+"://"+backend.Addr+parseParam.grpc.path(), "POST"
+	}
 	execInfo := ExecInfo{
 		BackendADDR: backend.Addr,
 		BackendURI:  uri,
+		Attempt:     attempt,
 		Success:     true,
 	}
-	req, err := http.NewRequest(ctx.routeInfo.Method, uri, strings.NewReader(parseParam.body.Encode()))
+	defer func() {
+		response.execInfoGroup = append(response.execInfoGroup, execInfo)
+	}()
+	response.Response, response.Error = nil, nil
+	response.Status, response.Header = 0, nil
+	req, _ := http.NewRequest(method, uri, bytes.NewReader(parseParam.encode()))
+	// 客户端断开连接或超时时取消请求
+	timeoutCtx, cancel := context.WithTimeout(ctx.base(), node.timeout(ctx, backend))
+	defer cancel()
+	req = req.WithContext(timeoutCtx)
 	// set header
 	for k, v := range parseParam.header {
 		req.Header.Set(k, v)
 	}
-	setDefaultHeader(ctx.routeInfo.Method, req)
+	parseParam.setContentType(method, req)
 	req.Header.Set("Gate-Cluster", cluster.Name)
 	req.Header.Set("X-Forwarded-For", ctx.ClientIP())
-	client := ctx.engine.Client()
-	defer ctx.engine.Release(client)
-	client.Timeout = time.Second * time.Duration(backend.Timeout)
 	atomic.AddUint64(&backend.Waiting, 1)
-	atomic.AddUint64(&backend.QPS, 1)
+	defer atomic.AddUint64(&backend.Waiting, ^uint64(-step-1))
 	now := time.Now()
-	res, err := client.Do(req)
-	execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
-	atomic.AddUint64(&backend.Waiting, ^uint64(-step-1))
+	res, err := backend.client().Do(req)
+	if err != nil && ctx.Err() != nil {
+		backend.abandon()
+		execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		response.Error = ctx.abortError()
+		return 0, err
+	}
 	if err != nil {
+		backend.observe(time.Since(now), true)
+		cluster.report(backend, 0, err)
+		execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
 		execInfo.Success = false
-		response.Error = BackendServiceError
-		goto WALK
+		execInfo.Error = err.Error()
+		response.Error = backendError(err)
+		return 0, err
 	}
 	defer res.Body.Close()
+	status = res.StatusCode
+	execInfo.Status = status
+	response.Status, response.Header = status, res.Header
 	response.Response, err = ioutil.ReadAll(res.Body)
+	if err == nil && parseParam.grpc != nil {
+		status, response.Response, err = parseParam.grpc.decode(res, response.Response)
+		execInfo.Status, response.Status = status, status
+	}
+	execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+	if err != nil && ctx.Err() != nil {
+		backend.abandon()
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		response.Error = ctx.abortError()
+		return status, err
+	}
+	// 5xx 与读取失败计入熔断统计
+	backend.observe(time.Since(now), err != nil || status >= http.StatusInternalServerError)
+	cluster.report(backend, status, err)
 	if err != nil {
 		execInfo.Success = false
-		response.Error = BackendServiceError
+		execInfo.Error = err.Error()
+		response.Error = backendError(err)
 	}
-WALK:
-	ctx.ExecInfoGroup = append(ctx.ExecInfoGroup, execInfo)
-	ctx.responses = append(ctx.responses, response)
-	return
+	return status, err
+}
+
+// timeout . 取节点与后端服务超时时间中较小的一个, 并且不超过路由剩余的时间
+func (node Node) timeout(ctx *Context, backend *Backend) time.Duration {
+	timeout := time.Duration(backend.Timeout) * time.Second
+	if node.Timeout > 0 && (timeout <= 0 || time.Duration(node.Timeout)*time.Millisecond < timeout) {
+		timeout = time.Duration(node.Timeout) * time.Millisecond
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return timeout
+}
+
+// backendError . 请求后端服务失败的错误 超时与其他错误区分
+func backendError(err error) error {
+	if isTimeout(err) {
+		return BackendTimeout
+	}
+	return BackendServiceError
 }
 
 func uriEncode(vals ...string) string {
@@ -189,9 +384,40 @@ func uriEncode(vals ...string) string {
 	return buffer.String()
 }
 
-func setDefaultHeader(method string, req *http.Request) {
-	switch method {
-	case "POST":
+// 按段转义路径, 保留通配参数中的 "/"
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, l := 0, len(segments); i < l; i++ {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+// encode . 请求体 有 JSON 参数时为 JSON 对象, 表单参数作为字符串合并到对象中
+func (parseParam ParseParam) encode() []byte {
+	if parseParam.grpc != nil {
+		return grpcFrame(0, parseParam.grpc.payload)
+	}
+	if len(parseParam.json) == 0 {
+		return []byte(parseParam.body.Encode())
+	}
+	for key := range parseParam.body {
+		if _, ok := parseParam.json[key]; !ok {
+			parseParam.json[key] = parseParam.body.Get(key)
+		}
+	}
+	b, _ := json.Marshal(parseParam.json)
+	return b
+}
+
+func (parseParam ParseParam) setContentType(method string, req *http.Request) {
+	switch {
+	case parseParam.grpc != nil:
+		req.Header.Set("Content-Type", grpcContentType)
+		req.Header.Set("Te", "trailers")
+	case len(parseParam.json) > 0:
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	case method == "POST" || len(parseParam.body) > 0:
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
 }
@@ -0,0 +1,246 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOutlierConsecutive5xx . 默认连续 5xx 次数
+	DefaultOutlierConsecutive5xx = 5
+	// DefaultOutlierConsecutiveTimeouts . 默认连续超时次数
+	DefaultOutlierConsecutiveTimeouts = 5
+	// DefaultOutlierIntervalInSeconds . 默认统计窗口
+	DefaultOutlierIntervalInSeconds = 10
+	// DefaultOutlierMinRequests . 默认统计错误率的最小请求数
+	DefaultOutlierMinRequests = 20
+	// DefaultOutlierBaseEjectionInSeconds . 默认基础摘除时间
+	DefaultOutlierBaseEjectionInSeconds = 30
+	// DefaultOutlierMaxEjectionInSeconds . 默认最长摘除时间
+	DefaultOutlierMaxEjectionInSeconds = 300
+	// DefaultOutlierMaxEjectionPercent . 默认最多摘除的比例
+	DefaultOutlierMaxEjectionPercent = 50
+
+	// 保留的摘除记录数
+	maxEjectionEvents = 20
+)
+
+type (
+	// OutlierSetting . 异常摘除配置 按集群设置
+	OutlierSetting struct {
+		// 是否开启
+		Enabled bool `json:"enabled"`
+		// 连续 5xx 次数
+		Consecutive5xx uint64 `json:"consecutive5xx"`
+		// 连续超时次数
+		ConsecutiveTimeouts uint64 `json:"consecutiveTimeouts"`
+		// 5xx/超时比例 0-1, 0 为不按比例摘除
+		ErrorRate float64 `json:"errorRate"`
+		// 统计比例的最小请求数
+		MinRequests uint64 `json:"minRequests"`
+		// 统计窗口(秒)
+		Interval int64 `json:"interval"`
+		// 基础摘除时间(秒) 每次摘除翻倍
+		BaseEjectionTime int64 `json:"baseEjectionTime"`
+		// 最长摘除时间(秒)
+		MaxEjectionTime int64 `json:"maxEjectionTime"`
+		// 最多摘除的后端服务比例 0-100, 至少保留一个后端服务
+		MaxEjectionPercent int `json:"maxEjectionPercent"`
+	}
+	// EjectionEvent . 摘除记录
+	EjectionEvent struct {
+		// 摘除时间
+		Time int64 `json:"time"`
+		// 恢复时间
+		Until int64 `json:"until"`
+		// 原因
+		Reason string `json:"reason"`
+	}
+	// OutlierState . 后端服务的异常统计
+	OutlierState struct {
+		mtx                 sync.Mutex
+		consecutive5xx      uint64
+		consecutiveTimeouts uint64
+		requests            uint64
+		errors              uint64
+		windowStart         time.Time
+		ejectedUntil        time.Time
+		ejections           uint64
+		events              []EjectionEvent
+	}
+)
+
+// 设置默认值
+func (setting OutlierSetting) getDefaultSetting() OutlierSetting {
+	if setting.Consecutive5xx < 1 {
+		setting.Consecutive5xx = DefaultOutlierConsecutive5xx
+	}
+	if setting.ConsecutiveTimeouts < 1 {
+		setting.ConsecutiveTimeouts = DefaultOutlierConsecutiveTimeouts
+	}
+	if setting.ErrorRate < 0 || setting.ErrorRate > 1 {
+		setting.ErrorRate = 0
+	}
+	if setting.MinRequests < 1 {
+		setting.MinRequests = DefaultOutlierMinRequests
+	}
+	if setting.Interval < 1 {
+		setting.Interval = DefaultOutlierIntervalInSeconds
+	}
+	if setting.BaseEjectionTime < 1 {
+		setting.BaseEjectionTime = DefaultOutlierBaseEjectionInSeconds
+	}
+	if setting.MaxEjectionTime < setting.BaseEjectionTime {
+		setting.MaxEjectionTime = DefaultOutlierMaxEjectionInSeconds
+		if setting.MaxEjectionTime < setting.BaseEjectionTime {
+			setting.MaxEjectionTime = setting.BaseEjectionTime
+		}
+	}
+	if setting.MaxEjectionPercent < 1 || setting.MaxEjectionPercent > 100 {
+		setting.MaxEjectionPercent = DefaultOutlierMaxEjectionPercent
+	}
+	return setting
+}
+
+// maxEjected . 最多可以摘除的后端服务数
+func (setting OutlierSetting) maxEjected(total int) int {
+	allowed := total * setting.MaxEjectionPercent / 100
+	if allowed < 1 {
+		allowed = 1
+	}
+	if allowed > total-1 {
+		allowed = total - 1
+	}
+	return allowed
+}
+
+func isTimeout(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+// ejected . 是否处于摘除状态
+func (state *OutlierState) ejected(now time.Time) bool {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	return now.Before(state.ejectedUntil)
+}
+
+// record . 记录请求结果, 达到摘除条件时返回原因
+func (state *OutlierState) record(setting OutlierSetting, status int, err error, now time.Time) string {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	if now.Before(state.ejectedUntil) {
+		return ""
+	}
+	if now.Sub(state.windowStart) > time.Duration(setting.Interval)*time.Second {
+		state.windowStart = now
+		state.requests = 0
+		state.errors = 0
+	}
+	state.requests++
+	timeout := err != nil && isTimeout(err)
+	serverError := status >= http.StatusInternalServerError
+	if timeout {
+		state.consecutiveTimeouts++
+	} else {
+		state.consecutiveTimeouts = 0
+	}
+	if serverError {
+		state.consecutive5xx++
+	} else {
+		state.consecutive5xx = 0
+	}
+	if timeout || serverError {
+		state.errors++
+	}
+	switch {
+	case state.consecutive5xx >= setting.Consecutive5xx:
+		return fmt.Sprintf("%d consecutive 5xx", state.consecutive5xx)
+	case state.consecutiveTimeouts >= setting.ConsecutiveTimeouts:
+		return fmt.Sprintf("%d consecutive timeouts", state.consecutiveTimeouts)
+	case setting.ErrorRate > 0 && state.requests >= setting.MinRequests &&
+		float64(state.errors)/float64(state.requests) >= setting.ErrorRate:
+		return fmt.Sprintf("error rate %.2f over %d requests", float64(state.errors)/float64(state.requests), state.requests)
+	}
+	return ""
+}
+
+// eject . 摘除, 摘除时间按次数指数增长
+func (state *OutlierState) eject(setting OutlierSetting, reason string, now time.Time) {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	maxEjection := time.Duration(setting.MaxEjectionTime) * time.Second
+	// 恢复后长时间正常则重新计算
+	if !state.ejectedUntil.IsZero() && now.Sub(state.ejectedUntil) > maxEjection {
+		state.ejections = 0
+	}
+	duration := time.Duration(setting.BaseEjectionTime) * time.Second
+	for i := uint64(0); i < state.ejections && duration < maxEjection; i++ {
+		duration *= 2
+	}
+	if duration > maxEjection {
+		duration = maxEjection
+	}
+	state.ejections++
+	state.ejectedUntil = now.Add(duration)
+	state.consecutive5xx = 0
+	state.consecutiveTimeouts = 0
+	state.requests = 0
+	state.errors = 0
+	state.events = append(state.events, EjectionEvent{
+		Time:   now.Unix(),
+		Until:  state.ejectedUntil.Unix(),
+		Reason: reason,
+	})
+	if len(state.events) > maxEjectionEvents {
+		state.events = state.events[len(state.events)-maxEjectionEvents:]
+	}
+}
+
+// MarshalJSON . 输出摘除状态与记录
+func (state *OutlierState) MarshalJSON() ([]byte, error) {
+	state.mtx.Lock()
+	defer state.mtx.Unlock()
+	events := make([]EjectionEvent, len(state.events))
+	copy(events, state.events)
+	return json.Marshal(H{
+		"ejected":   time.Now().Before(state.ejectedUntil),
+		"ejections": state.ejections,
+		"events":    events,
+	})
+}
+
+// report . 记录后端服务的请求结果, 按集群配置判断是否摘除
+func (cluster *Cluster) report(backend *Backend, status int, err error) {
+	cluster.rwMutex.RLock()
+	setting := cluster.Outlier
+	cluster.rwMutex.RUnlock()
+	if !setting.Enabled || backend.Outlier == nil {
+		return
+	}
+	setting = setting.getDefaultSetting()
+	now := time.Now()
+	reason := backend.Outlier.record(setting, status, err, now)
+	if reason == "" {
+		return
+	}
+	cluster.rwMutex.Lock()
+	defer cluster.rwMutex.Unlock()
+	ejected := 0
+	for i, l := 0, len(cluster.backends); i < l; i++ {
+		if cluster.backends[i].Outlier != nil && cluster.backends[i].Outlier.ejected(now) {
+			ejected++
+		}
+	}
+	if ejected >= setting.maxEjected(len(cluster.backends)) {
+		return
+	}
+	backend.Outlier.eject(setting, reason, now)
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCluster_Outlier(t *testing.T) {
+	cluster := &Cluster{Name: "test", Outlier: OutlierSetting{
+		Enabled:            true,
+		Consecutive5xx:     2,
+		BaseEjectionTime:   10,
+		MaxEjectionTime:    30,
+		MaxEjectionPercent: 50,
+	}}
+	for _, addr := range []string{"a", "b", "c"} {
+		backend := &Backend{Addr: addr, HeartDisabled: true}
+		backend.getDefaultSetting()
+		cluster.backends = append(cluster.backends, backend)
+	}
+	a, b := cluster.backends[0], cluster.backends[1]
+	cluster.report(a, 500, nil)
+	cluster.report(a, 200, nil)
+	cluster.report(a, 502, nil)
+	if !a.available() {
+		t.Fatal("non consecutive 5xx should not eject")
+	}
+	cluster.report(a, 503, nil)
+	if a.available() {
+		t.Fatal("a should be ejected")
+	}
+	// 超过最大摘除比例
+	cluster.report(b, 500, nil)
+	cluster.report(b, 500, nil)
+	if !b.available() {
+		t.Fatal("b should not be ejected over max ejection percent")
+	}
+	if len(a.Outlier.events) != 1 || a.Outlier.events[0].Until-a.Outlier.events[0].Time != 10 {
+		t.Fatalf("unexpected ejection events %v", a.Outlier.events)
+	}
+	// 再次摘除时间翻倍, 不超过最长摘除时间
+	for i, want := range []int64{20, 30} {
+		a.Outlier.ejectedUntil = time.Now().Add(-time.Second)
+		cluster.report(a, 500, nil)
+		cluster.report(a, 500, nil)
+		event := a.Outlier.events[i+1]
+		if event.Until-event.Time != want {
+			t.Fatalf("want ejection %ds, got %ds", want, event.Until-event.Time)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package gateway
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// 流式转发每次读取的大小
+const streamBufferSize = 32 * 1024
+
+// 逐跳头部 只对单个连接有效, 转发时需要去掉
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders . 去掉逐跳头部以及 Connection 中声明的头部
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				header.Del(key)
+			}
+		}
+	}
+	for i, l := 0, len(hopHeaders); i < l; i++ {
+		header.Del(hopHeaders[i])
+	}
+}
+
+// 复制头部 已存在的头部会被覆盖
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+}
+
+// 不跟随后端服务的跳转, 由客户端处理
+func noRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// passthrough . 透传模式 原样转发请求, 后端服务的响应直接写回客户端
+// Rewrite 为空时使用原始路径, ParamGroup 不生效
+// 流式转发时超时时间只限制收到响应头之前, 之后边读边写直到后端服务结束或客户端断开
+// gRPC 请求总是流式转发并保留 trailer, gRPC-Web 请求转为 gRPC 请求后转发
+func (node Node) passthrough(ctx *Context) {
+	grpc, web := isGRPC(ctx.Request), isGRPCWeb(ctx.Request)
+	stream := ctx.routeInfo.Stream || grpc
+	has, cluster := ctx.engine.clusters.Get(node.Cluster)
+	if !has {
+		ctx.Render(http.StatusBadGateway, ClusterNotFound)
+		return
+	}
+	backend, err := cluster.Balance(ctx)
+	if err != nil {
+		ctx.Render(http.StatusBadGateway, err)
+		return
+	}
+	path := ctx.Request.URL.EscapedPath()
+	if node.Rewrite != "" {
+		path = node.rewrite(ctx, nil)
+	}
+	uri := backend.Schema + "://" + backend.Addr + path
+	if ctx.Request.URL.RawQuery != "" {
+		uri += "?" + ctx.Request.URL.RawQuery
+	}
+	execInfo := ExecInfo{
+		BackendADDR: backend.Addr,
+		BackendURI:  uri,
+		Attempt:     1,
+		Success:     true,
+	}
+	defer func() {
+		ctx.ExecInfoGroup = append(ctx.ExecInfoGroup, execInfo)
+	}()
+	req, err := http.NewRequest(ctx.Request.Method, uri, ctx.Request.Body)
+	if err != nil {
+		backend.abandon()
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		ctx.Render(http.StatusBadGateway, BackendServiceError)
+		return
+	}
+	var timeoutCtx context.Context
+	var cancel context.CancelFunc
+	// 流式转发收到响应头后停止计时
+	var timer *time.Timer
+	var expired int32
+	if stream {
+		timeoutCtx, cancel = context.WithCancel(ctx.Request.Context())
+		timer = time.AfterFunc(node.timeout(ctx, backend), func() {
+			atomic.StoreInt32(&expired, 1)
+			cancel()
+		})
+	} else {
+		timeoutCtx, cancel = context.WithTimeout(ctx.base(), node.timeout(ctx, backend))
+	}
+	defer cancel()
+	req = req.WithContext(timeoutCtx)
+	req.ContentLength = ctx.Request.ContentLength
+	copyHeader(req.Header, ctx.Request.Header)
+	removeHopHeaders(req.Header)
+	req.Host = ctx.Request.Host
+	req.Header.Set("Gate-Cluster", cluster.Name)
+	if clientIP := ctx.ClientIP(); clientIP != "" {
+		req.Header.Set("X-Forwarded-For", clientIP)
+	}
+	if grpc {
+		req.Header.Set("Te", "trailers")
+	}
+	if web {
+		req.Body = ioutil.NopCloser(grpcWebRequest(req, ctx.Request.Body))
+	}
+	client := *backend.client()
+	client.CheckRedirect = noRedirect
+	atomic.AddUint64(&backend.Waiting, 1)
+	defer atomic.AddUint64(&backend.Waiting, ^uint64(-step-1))
+	now := time.Now()
+	res, err := client.Do(req)
+	elapsed := time.Since(now)
+	if timer != nil {
+		timer.Stop()
+	}
+	if err != nil {
+		execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		if ctx.Err() != nil {
+			backend.abandon()
+			ctx.Render(http.StatusGatewayTimeout, ctx.abortError())
+			return
+		}
+		backend.observe(time.Since(now), true)
+		cluster.report(backend, 0, err)
+		if err = backendError(err); atomic.LoadInt32(&expired) == 1 {
+			err = BackendTimeout
+		}
+		if err == BackendTimeout {
+			ctx.Render(http.StatusGatewayTimeout, err)
+			return
+		}
+		ctx.Render(http.StatusBadGateway, err)
+		return
+	}
+	defer res.Body.Close()
+	execInfo.Status = res.StatusCode
+	var body io.Reader = res.Body
+	if web {
+		body = grpcWebResponse(res, isGRPCWebText(ctx.Request))
+	}
+	removeHopHeaders(res.Header)
+	copyHeader(ctx.Writer.Header(), res.Header)
+	ctx.Writer.WriteHeader(res.StatusCode)
+	ctx.Writer.WriteHeaderNow()
+	if stream {
+		err = ctx.streamBody(body, cancel)
+	} else {
+		_, err = io.Copy(ctx.Writer, body)
+	}
+	if grpc && !web {
+		grpcTrailers(ctx.Writer.Header(), res)
+	}
+	execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+	if err == RequestCanceled || (err != nil && ctx.Err() != nil) {
+		backend.abandon()
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		return
+	}
+	// 流式转发的时长取决于客户端, 只统计收到响应头的时间
+	if !stream {
+		elapsed = time.Since(now)
+	}
+	backend.observe(elapsed, err != nil || res.StatusCode >= http.StatusInternalServerError)
+	cluster.report(backend, res.StatusCode, err)
+	if err != nil {
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+	}
+}
+
+// streamBody . 边读边写 每次写入后立即刷新, 客户端断开时通过 cancel 取消后端服务的请求
+func (c *Context) streamBody(body io.Reader, cancel context.CancelFunc) (err error) {
+	// Stream 只在两次写入之间检查, 读取阻塞时由 CloseNotify 取消
+	clientGone := c.Writer.CloseNotify()
+	done := make(chan struct{})
+	defer close(done)
+	var gone int32
+	go func() {
+		select {
+		case <-clientGone:
+			atomic.StoreInt32(&gone, 1)
+			cancel()
+		case <-done:
+		}
+	}()
+	buf := make([]byte, streamBufferSize)
+	c.Stream(func(w io.Writer) bool {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err = w.Write(buf[:n]); err != nil {
+				return false
+			}
+		}
+		if readErr != nil && readErr != io.EOF {
+			err = readErr
+		}
+		return readErr == nil
+	})
+	if atomic.LoadInt32(&gone) == 1 {
+		return RequestCanceled
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPassthrough(t *testing.T) {
+	payload := []byte{0, 1, 2, 0xff}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "PUT" || r.URL.Path != "/files/42" || r.URL.RawQuery != "a=1&b=2" ||
+			r.Header.Get("X-Custom") != "v" || r.Header.Get("Keep-Alive") != "" || !bytes.Equal(body, payload) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(payload)
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "files"})
+	_, cluster := engine.Cluster("files")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	engine.Route(RouteInfo{Method: "PUT", URL: "/upload/:id", Passthrough: true, NodeGroup: []Node{
+		{Cluster: "files", Rewrite: "/files/{id}"},
+	}})
+	engine.Route(RouteInfo{Method: "GET", URL: "/redirect", Passthrough: true, NodeGroup: []Node{
+		{Cluster: "files"},
+	}})
+
+	req := httptest.NewRequest("PUT", "/upload/42?a=1&b=2", bytes.NewReader(payload))
+	req.Header.Set("X-Custom", "v")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || w.Header().Get("ETag") != `"abc"` || !bytes.Equal(w.Body.Bytes(), payload) {
+		t.Fatalf("unexpected response %d %v %v", w.Code, w.Header(), w.Body.Bytes())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/redirect", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/elsewhere" {
+		t.Fatalf("redirect should be passed to client, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestPassthroughStream(t *testing.T) {
+	canceled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				close(canceled)
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "events"})
+	_, cluster := engine.Cluster("events")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	engine.Route(RouteInfo{Method: "GET", URL: "/events", Stream: true, Timeout: 150, NodeGroup: []Node{
+		{Cluster: "events"},
+	}})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected header %v", res.Header)
+	}
+	reader := bufio.NewReader(res.Body)
+	// 每个事件在后端服务写入后立即收到, 超过路由的超时时间后仍然继续
+	for i := 0; i < 4; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != fmt.Sprintf("data: %d\n", i) {
+			t.Fatalf("unexpected event %q %v", line, err)
+		}
+		reader.ReadString('\n')
+	}
+	// 客户端断开后取消后端服务的请求
+	res.Body.Close()
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend request should be canceled after client is gone")
+	}
+}
@@ -1,9 +1,6 @@
 package gateway
 
-import (
-	"net/http"
-	"sync"
-)
+import "net/http"
 
 type Proxy struct {
 }
@@ -23,21 +20,35 @@ func (p Proxy) Version() string {
 func (p Proxy) Handle(ctx *Context) {
 	ctx.Writer.Header().Set("Server", "Gate 0.1")
 	nodes := len(ctx.RouteInfo().NodeGroup)
-	switch nodes {
-	case 0:
+	switch {
+	case nodes == 0:
 		ctx.Render(http.StatusOK, BackendServiceError)
 		return
-	case 1:
+	case isWebSocket(ctx.Request):
+		// WebSocket 只使用第一个节点
+		ctx.RouteInfo().NodeGroup[0].websocket(ctx)
+		return
+	case ctx.RouteInfo().Passthrough, ctx.RouteInfo().Stream, isGRPC(ctx.Request):
+		ctx.RouteInfo().NodeGroup[0].passthrough(ctx)
+		return
+	case nodes == 1:
 		// 执行单个节点
-		ctx.RouteInfo().NodeGroup[0].Do(ctx, nil)
+		ctx.collect(ctx.RouteInfo().NodeGroup[0].Do(ctx))
 	default:
-		// 合并执行多个节点
-		wg := &sync.WaitGroup{}
-		wg.Add(nodes)
-		for i := 0; i < nodes; i++ {
-			go ctx.RouteInfo().NodeGroup[i].Do(ctx, wg)
-		}
-		wg.Wait()
+		// 合并执行多个节点, 按依赖关系并行或依次执行 结果按 NodeGroup 的顺序合并
+		ctx.parseForm()
+		ctx.collect(ctx.routeInfo.graph.run(ctx, ctx.RouteInfo().NodeGroup)...)
+	}
+	if err := ctx.requiredFailure(); err != nil {
+		ctx.Render(failureStatus(err), err)
+		return
+	}
+	ctx.writeHeaders(ctx.responses)
+	status := ctx.routeInfo.status(ctx.responses)
+	if !bodyAllowedForStatus(status) {
+		ctx.Status(status)
+		ctx.Writer.WriteHeaderNow()
+		return
 	}
-	ctx.Render(http.StatusOK, nil)
+	ctx.Render(status, nil)
 }
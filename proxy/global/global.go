@@ -2,6 +2,7 @@ package global
 
 import (
 	"encoding/json"
+	"fmt"
 	"goodsogood/gateway"
 	"goodsogood/gateway/proxy/types"
 
@@ -9,9 +10,11 @@ import (
 )
 
 const (
-	CLUSTER_INDEX_KEY = "cluster"
-	BACKEND_INDEX_KEY = "backend"
-	API_INDEX_KEY     = "api"
+	CLUSTER_INDEX_KEY    = "cluster"
+	BACKEND_INDEX_KEY    = "backend"
+	API_INDEX_KEY        = "api"
+	DESCRIPTOR_INDEX_KEY = "descriptor"
+	THRIFT_INDEX_KEY     = "thrift"
 )
 
 type GlobalStore struct {
@@ -25,11 +28,18 @@ func init() {
 	Store = &GlobalStore{}
 }
 
+// APIKey . 路由规则存储的key api:DOMAIN:METHOD:URL 域名与路由表一致统一格式
+func APIKey(domain, method, url string) string {
+	return fmt.Sprintf("api:%s:%s:%s", gateway.NormalizeDomain(domain), method, url)
+}
+
 func (s *GlobalStore) SetDB(db *buntdb.DB) {
 	s.db = db
 	db.CreateIndex(CLUSTER_INDEX_KEY, "cluster:*", buntdb.IndexString)
 	db.CreateIndex(BACKEND_INDEX_KEY, "backend:*", buntdb.IndexString)
 	db.CreateIndex(API_INDEX_KEY, "api:*", buntdb.IndexString)
+	db.CreateIndex(DESCRIPTOR_INDEX_KEY, "descriptor:*", buntdb.IndexString)
+	db.CreateIndex(THRIFT_INDEX_KEY, "thrift:*", buntdb.IndexString)
 }
 
 func (s *GlobalStore) CloseDB() error {
@@ -49,6 +59,7 @@ func (s *GlobalStore) Proxy() *gateway.Engine {
 }
 
 func (s *GlobalStore) LoadCache() {
+	migrate := make(map[string]string)
 	s.db.View(func(tx *buntdb.Tx) error {
 		err := tx.Ascend("cluster", func(key, value string) bool {
 			// handle cluster
@@ -64,26 +75,46 @@ func (s *GlobalStore) LoadCache() {
 			json.Unmarshal([]byte(value), &backendInfo)
 			has, cluster := s.proxy.Cluster(backendInfo.ClusterName)
 			if has {
-				cluster.Add(&gateway.Backend{
-					Addr:              backendInfo.Addr,
-					Schema:            backendInfo.Schema,
-					HeartPath:         backendInfo.HeartPath,
-					HeartDisabled:     backendInfo.HeartDisabled,
-					HeartResponseBody: backendInfo.HeartResponseBody,
-					HeartDuration:     backendInfo.HeartDuration,
-					Timeout:           backendInfo.Timeout,
-					MaxQPS:            backendInfo.MaxQPS,
-				})
+				cluster.Add(backendInfo.Backend())
 			}
 
 			return true
 		})
+		// 描述集与 IDL 在路由之前加载
+		err = tx.Ascend("descriptor", func(key, value string) bool {
+			var descriptorInfo types.DescriptorInfo
+			json.Unmarshal([]byte(value), &descriptorInfo)
+			s.proxy.AddDescriptorSet(descriptorInfo.Name, descriptorInfo.Data)
+			return true
+		})
+		err = tx.Ascend("thrift", func(key, value string) bool {
+			var idlInfo types.ThriftIDLInfo
+			json.Unmarshal([]byte(value), &idlInfo)
+			s.proxy.AddThriftIDL(idlInfo.Name, idlInfo.Content)
+			return true
+		})
 		err = tx.Ascend("api", func(key, value string) bool {
 			var routeInfo gateway.RouteInfo
 			json.Unmarshal([]byte(value), &routeInfo)
 			s.proxy.Route(routeInfo)
+			if apiKey := APIKey(routeInfo.Domain, routeInfo.Method, routeInfo.URL); apiKey != key {
+				migrate[key] = apiKey
+			}
 			return true
 		})
 		return err
 	})
+	// 旧版本的key api:METHOD:URL 与未统一域名格式的key 迁移到新的格式
+	if len(migrate) > 0 {
+		s.db.Update(func(tx *buntdb.Tx) error {
+			for oldKey, newKey := range migrate {
+				value, err := tx.Delete(oldKey)
+				if err != nil {
+					continue
+				}
+				tx.Set(newKey, value, nil)
+			}
+			return nil
+		})
+	}
 }
@@ -2,7 +2,6 @@ package handle
 
 import (
 	"encoding/json"
-	"fmt"
 	"goodsogood/gateway"
 	"goodsogood/gateway/proxy/global"
 	"net/http"
@@ -44,9 +43,10 @@ func AddAPI(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.ToManyNodes)
 		return
 	}
+	form.Domain = gateway.NormalizeDomain(form.Domain)
 	global.Store.DB().Update(func(tx *buntdb.Tx) error {
 		apiByte, _ := json.Marshal(form)
-		key := fmt.Sprintf("api:%s:%s", form.Method, form.URL)
+		key := global.APIKey(form.Domain, form.Method, form.URL)
 		_, _, err := tx.Set(key, string(apiByte), nil)
 		return err
 	})
@@ -54,6 +54,7 @@ func AddAPI(ctx *gin.Context) {
 }
 
 type UpdateApiForm struct {
+	Domain string            `json:"domain"`
 	Method string            `json:"method"`
 	URL    string            `json:"url"`
 	Info   gateway.RouteInfo `json:"info"`
@@ -71,10 +72,16 @@ func UpdateAPI(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.ToManyNodes)
 		return
 	}
-	global.Store.Proxy().UpdateRoute(form.Method, form.URL, form.Info)
+	if err := global.Store.Proxy().UpdateRoute(form.Domain, form.Method, form.URL, form.Info); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	form.Info.Domain = gateway.NormalizeDomain(form.Info.Domain)
 	global.Store.DB().Update(func(tx *buntdb.Tx) error {
 		apiByte, _ := json.Marshal(form.Info)
-		key := fmt.Sprintf("api:%s:%s", form.Method, form.URL)
+		// 域名/Method/URL 变化后key也随之变化
+		tx.Delete(global.APIKey(form.Domain, form.Method, form.URL))
+		key := global.APIKey(form.Info.Domain, form.Info.Method, form.Info.URL)
 		_, _, err := tx.Set(key, string(apiByte), nil)
 		return err
 	})
@@ -82,6 +89,7 @@ func UpdateAPI(ctx *gin.Context) {
 }
 
 type DeleteApiForm struct {
+	Domain string `json:"domain"`
 	Method string `json:"method"`
 	URL    string `json:"url"`
 }
@@ -97,9 +105,9 @@ func DeleteAPI(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.URLNotValid)
 		return
 	}
-	global.Store.Proxy().UnRoute(form.Method, form.URL)
+	global.Store.Proxy().UnRoute(form.Domain, form.Method, form.URL)
 	global.Store.DB().Update(func(tx *buntdb.Tx) error {
-		key := fmt.Sprintf("api:%s:%s", form.Method, form.URL)
+		key := global.APIKey(form.Domain, form.Method, form.URL)
 		_, err := tx.Delete(key)
 		return err
 	})
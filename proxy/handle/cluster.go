@@ -22,15 +22,21 @@ func Clusters(ctx *gin.Context) {
 			if err := json.Unmarshal([]byte(value), &clusterInfo); err == nil {
 				info["clusterName"] = clusterInfo.Name
 				info["description"] = clusterInfo.Description
+				info["loadBalance"] = clusterInfo.LoadBalance
+				info["hashOn"] = clusterInfo.HashOn
+				info["hashKey"] = clusterInfo.HashKey
+				info["outlier"] = clusterInfo.Outlier
 			} else {
 				info["clusterName"] = value
 				info["description"] = ""
+				info["loadBalance"] = ""
 			}
 			clusterName, _ := info["clusterName"]
 			has, cluster := global.Store.Proxy().Cluster(clusterName.(string))
 			if has {
 				info["exist"] = true
 				info["backendNum"] = cluster.Backends().Len()
+				info["loadBalance"] = cluster.LoadBalance
 			}
 			clusters = append(clusters, info)
 			return true
@@ -55,7 +61,14 @@ func AddCluster(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.ClusterNameEmpty)
 		return
 	}
-	cluster := &gateway.Cluster{Name: form.Name, Description: form.Description}
+	cluster := &gateway.Cluster{
+		Name:        form.Name,
+		Description: form.Description,
+		LoadBalance: form.LoadBalance,
+		HashOn:      form.HashOn,
+		HashKey:     form.HashKey,
+		Outlier:     form.Outlier,
+	}
 	if err := global.Store.Proxy().AddCluster(cluster); err != nil {
 		ctx.JSON(http.StatusOK, err)
 		return
@@ -81,8 +94,18 @@ func UpdateCluster(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.ClusterNameEmpty)
 		return
 	}
-	cluster := &gateway.Cluster{Name: form.Name, Description: form.Description}
-	global.Store.Proxy().Update(cluster)
+	cluster := &gateway.Cluster{
+		Name:        form.Name,
+		Description: form.Description,
+		LoadBalance: form.LoadBalance,
+		HashOn:      form.HashOn,
+		HashKey:     form.HashKey,
+		Outlier:     form.Outlier,
+	}
+	if err := global.Store.Proxy().Update(cluster); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
 	global.Store.DB().Update(func(tx *buntdb.Tx) error {
 		clusterByte, _ := json.Marshal(cluster)
 		key := fmt.Sprintf("cluster:%s", form.Name)
@@ -158,7 +181,7 @@ func AddBackend(ctx *gin.Context) {
 		return
 	}
 	// schema
-	if form.Schema != "http" && form.Schema != "https" {
+	if form.Schema != "http" && form.Schema != "https" && form.Schema != "thrift" {
 		ctx.JSON(http.StatusOK, gateway.SchemaUnknowable)
 		return
 	}
@@ -167,8 +190,8 @@ func AddBackend(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.AddrUnknowable)
 		return
 	}
-	// heartPath
-	if !form.HeartDisabled && len(form.HeartPath) < 1 {
+	// heartPath tcp 检查与 thrift 后端服务不需要
+	if !form.HeartDisabled && form.HealthCheck.Type != gateway.HealthCheckTCP && form.Schema != "thrift" && len(form.HeartPath) < 1 {
 		ctx.JSON(http.StatusOK, gateway.HeartPathNotEmpty)
 		return
 	}
@@ -177,16 +200,7 @@ func AddBackend(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.MaxQPSNotZero)
 		return
 	}
-	backend := &gateway.Backend{
-		Addr:              form.Addr,
-		Schema:            form.Schema,
-		HeartPath:         form.HeartPath,
-		HeartDisabled:     form.HeartDisabled,
-		HeartResponseBody: form.HeartResponseBody,
-		HeartDuration:     form.HeartDuration,
-		Timeout:           form.Timeout,
-		MaxQPS:            form.MaxQPS,
-	}
+	backend := form.Backend()
 	if err := cluster.Add(backend); err != nil {
 		ctx.JSON(http.StatusOK, err)
 		return
@@ -220,7 +234,7 @@ func UpdateBackend(ctx *gin.Context) {
 		return
 	}
 	// schema
-	if form.Backend.Schema != "http" && form.Backend.Schema != "https" {
+	if form.Backend.Schema != "http" && form.Backend.Schema != "https" && form.Backend.Schema != "thrift" {
 		ctx.JSON(http.StatusOK, gateway.SchemaUnknowable)
 		return
 	}
@@ -229,8 +243,8 @@ func UpdateBackend(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.AddrUnknowable)
 		return
 	}
-	// heartPath
-	if !form.Backend.HeartDisabled && len(form.Backend.HeartPath) < 1 {
+	// heartPath tcp 检查与 thrift 后端服务不需要
+	if !form.Backend.HeartDisabled && form.Backend.HealthCheck.Type != gateway.HealthCheckTCP && form.Backend.Schema != "thrift" && len(form.Backend.HeartPath) < 1 {
 		ctx.JSON(http.StatusOK, gateway.HeartPathNotEmpty)
 		return
 	}
@@ -239,16 +253,19 @@ func UpdateBackend(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gateway.MaxQPSNotZero)
 		return
 	}
-	backend := &gateway.Backend{
-		Addr:              form.Backend.Addr,
-		Schema:            form.Backend.Schema,
-		HeartPath:         form.Backend.HeartPath,
-		HeartResponseBody: form.Backend.HeartResponseBody,
-		HeartDuration:     form.Backend.HeartDuration,
-		Timeout:           form.Backend.Timeout,
-		MaxQPS:            form.Backend.MaxQPS,
+	// 私钥不会返回给管理后台, 未重新填写时沿用已保存的私钥
+	if form.Backend.TLS.Key == "" && form.Backend.TLS.Cert != "" {
+		if has, old := cluster.Backend(form.Addr); has {
+			form.Backend.TLS.Key = old.TLS.Key
+		}
 	}
-	var key string
+	// tls 与健康检查
+	if err := form.Backend.Backend().Validate(); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	backend := form.Backend.Backend()
+	key := fmt.Sprintf("backend:%s", backend.Addr)
 	if backend.Addr != form.Addr {
 		// 变换了addr
 		cluster.Remove(form.Addr)
@@ -256,13 +273,15 @@ func UpdateBackend(ctx *gin.Context) {
 			ctx.JSON(http.StatusOK, err)
 			return
 		}
-		key = fmt.Sprintf("backend:%s", form.Addr)
 	} else {
 		cluster.Update(backend)
-		key = fmt.Sprintf("backend:%s", backend.Addr)
 	}
 	global.Store.DB().Update(func(tx *buntdb.Tx) error {
-		backendByte, _ := json.Marshal(backend)
+		if backend.Addr != form.Addr {
+			tx.Delete(fmt.Sprintf("backend:%s", form.Addr))
+		}
+		// 与 AddBackend 一致保存 BackendInfo, 加载时需要 clusterName
+		backendByte, _ := json.Marshal(form.Backend)
 		_, _, err := tx.Set(key, string(backendByte), nil)
 		return err
 	})
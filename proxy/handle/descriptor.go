@@ -0,0 +1,62 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"goodsogood/gateway"
+	"goodsogood/gateway/proxy/global"
+	"goodsogood/gateway/proxy/types"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/buntdb"
+)
+
+// Descriptors . 已注册的 protobuf 描述集
+func Descriptors(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": global.Store.Proxy().DescriptorSets(),
+	})
+}
+
+// AddDescriptor . 上传 protobuf 描述集 同名的描述集会被替换
+func AddDescriptor(ctx *gin.Context) {
+	var form types.DescriptorInfo
+	err := ctx.BindJSON(&form)
+	if err != nil || len(form.Name) < 1 {
+		ctx.JSON(http.StatusOK, gateway.ParamParseFailed)
+		return
+	}
+	if err := global.Store.Proxy().AddDescriptorSet(form.Name, form.Data); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	global.Store.DB().Update(func(tx *buntdb.Tx) error {
+		descriptorByte, _ := json.Marshal(form)
+		key := fmt.Sprintf("descriptor:%s", form.Name)
+		_, _, err := tx.Set(key, string(descriptorByte), nil)
+		return err
+	})
+	ctx.JSON(http.StatusOK, gateway.SUCCESS)
+}
+
+// DelDescriptor . 删除 protobuf 描述集
+func DelDescriptor(ctx *gin.Context) {
+	var form types.DescriptorInfo
+	err := ctx.BindJSON(&form)
+	if err != nil || len(form.Name) < 1 {
+		ctx.JSON(http.StatusOK, gateway.ParamParseFailed)
+		return
+	}
+	if err := global.Store.Proxy().RemoveDescriptorSet(form.Name); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	global.Store.DB().Update(func(tx *buntdb.Tx) error {
+		key := fmt.Sprintf("descriptor:%s", form.Name)
+		_, err := tx.Delete(key)
+		return err
+	})
+	ctx.JSON(http.StatusOK, gateway.SUCCESS)
+}
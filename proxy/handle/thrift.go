@@ -0,0 +1,62 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"goodsogood/gateway"
+	"goodsogood/gateway/proxy/global"
+	"goodsogood/gateway/proxy/types"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/buntdb"
+)
+
+// ThriftIDLs . 已注册的 thrift IDL
+func ThriftIDLs(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": global.Store.Proxy().ThriftIDLs(),
+	})
+}
+
+// AddThriftIDL . 上传 thrift IDL 同名的 IDL 会被替换
+func AddThriftIDL(ctx *gin.Context) {
+	var form types.ThriftIDLInfo
+	err := ctx.BindJSON(&form)
+	if err != nil || len(form.Name) < 1 {
+		ctx.JSON(http.StatusOK, gateway.ParamParseFailed)
+		return
+	}
+	if err := global.Store.Proxy().AddThriftIDL(form.Name, form.Content); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	global.Store.DB().Update(func(tx *buntdb.Tx) error {
+		idlByte, _ := json.Marshal(form)
+		key := fmt.Sprintf("thrift:%s", form.Name)
+		_, _, err := tx.Set(key, string(idlByte), nil)
+		return err
+	})
+	ctx.JSON(http.StatusOK, gateway.SUCCESS)
+}
+
+// DelThriftIDL . 删除 thrift IDL
+func DelThriftIDL(ctx *gin.Context) {
+	var form types.ThriftIDLInfo
+	err := ctx.BindJSON(&form)
+	if err != nil || len(form.Name) < 1 {
+		ctx.JSON(http.StatusOK, gateway.ParamParseFailed)
+		return
+	}
+	if err := global.Store.Proxy().RemoveThriftIDL(form.Name); err != nil {
+		ctx.JSON(http.StatusOK, err)
+		return
+	}
+	global.Store.DB().Update(func(tx *buntdb.Tx) error {
+		key := fmt.Sprintf("thrift:%s", form.Name)
+		_, err := tx.Delete(key)
+		return err
+	})
+	ctx.JSON(http.StatusOK, gateway.SUCCESS)
+}
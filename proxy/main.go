@@ -82,6 +82,18 @@ func main() {
 	api.POST("/api/update", handle.UpdateAPI)
 	// 删除路由规则
 	api.POST("/api/delete", handle.DeleteAPI)
+	// 获取所有的 protobuf 描述集
+	api.GET("/descriptors", handle.Descriptors)
+	// 上传 protobuf 描述集
+	api.POST("/descriptor", handle.AddDescriptor)
+	// 删除 protobuf 描述集
+	api.POST("/descriptor/delete", handle.DelDescriptor)
+	// 获取所有的 thrift IDL
+	api.GET("/thrift/idls", handle.ThriftIDLs)
+	// 上传 thrift IDL
+	api.POST("/thrift/idl", handle.AddThriftIDL)
+	// 删除 thrift IDL
+	api.POST("/thrift/idl/delete", handle.DelThriftIDL)
 	go router.Run(":8081")
 	go engine.Run(":80")
 	engine.RunTLS("", "./cert/_.goodsogood.com.pem", "./cert/_.goodsogood.com.key")
@@ -147,10 +147,13 @@ func (authPlugin *AuthPlugin) Handle(ctx *gateway.Context) {
 		return
 	}
 	if res.GetCode() != 0 {
-		ctx.Render(http.StatusOK, errors.New(int(res.GetCode()), res.GetMessage()))
+		// 令牌校验未通过, gRPC 请求返回 UNAUTHENTICATED
+		ctx.Render(http.StatusOK, gateway.GRPCStatusError{Status: gateway.GRPCUnauthenticated, Err: errors.New(int(res.GetCode()), res.GetMessage())})
 		ctx.Abort()
 		return
 	}
+	// 供一致性哈希等后续处理使用
+	ctx.Set("userId", userId)
 	ctx.Next()
 }
 
@@ -1,8 +1,18 @@
 package types
 
+import "goodsogood/gateway"
+
 type ClusterInfo struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// 负载均衡策略
+	LoadBalance string `json:"loadBalance"`
+	// 一致性哈希的取值来源 header|query|cookie|userId|ip
+	HashOn string `json:"hashOn"`
+	// 一致性哈希的取值名称
+	HashKey string `json:"hashKey"`
+	// 异常摘除配置
+	Outlier gateway.OutlierSetting `json:"outlier"`
 }
 
 type BackendInfo struct {
@@ -17,8 +27,51 @@ type BackendInfo struct {
 	HeartResponseBody string `json:"heartResponseBody"`
 	// 心跳时间
 	HeartDuration int64 `json:"heartDuration"`
+	// 健康检查配置
+	HealthCheck gateway.HealthCheck `json:"healthCheck"`
 	// 请求超时
 	Timeout int64 `json:"Timeout"`
 	// 最大qps
 	MaxQPS uint64 `json:"maxQPS"`
+	// 权重
+	Weight int64 `json:"weight"`
+	// 熔断配置
+	Breaker gateway.BreakerSetting `json:"breaker"`
+	// 连接配置
+	Transport gateway.TransportSetting `json:"transport"`
+	// TLS 配置
+	TLS gateway.TLSSetting `json:"tls"`
+}
+
+// Backend . 转换为后端服务
+func (info BackendInfo) Backend() *gateway.Backend {
+	return &gateway.Backend{
+		Addr:              info.Addr,
+		Schema:            info.Schema,
+		HeartPath:         info.HeartPath,
+		HeartDisabled:     info.HeartDisabled,
+		HeartResponseBody: info.HeartResponseBody,
+		HeartDuration:     info.HeartDuration,
+		HealthCheck:       info.HealthCheck,
+		Timeout:           info.Timeout,
+		MaxQPS:            info.MaxQPS,
+		Weight:            info.Weight,
+		Breaker:           info.Breaker,
+		Transport:         info.Transport,
+		TLS:               info.TLS,
+	}
+}
+
+type DescriptorInfo struct {
+	// 描述集名称
+	Name string `json:"name"`
+	// protoc --include_imports --descriptor_set_out 生成的描述集 base64 编码
+	Data []byte `json:"data"`
+}
+
+type ThriftIDLInfo struct {
+	// IDL 名称
+	Name string `json:"name"`
+	// IDL 内容
+	Content string `json:"content"`
 }
@@ -55,7 +55,7 @@ func (w *responseWriter) reset(writer http.ResponseWriter) {
 func (w *responseWriter) WriteHeader(code int) {
     if code > 0 && w.status != code {
         if w.Written() {
-            fmt.Println("[WARNING] Headers were already written. Wanted to override status code %d with %d", w.status, code)
+            fmt.Printf("[WARNING] Headers were already written. Wanted to override status code %d with %d\n", w.status, code)
         }
         w.status = code
     }
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	// RetryOnError . 任意请求错误时重试
+	RetryOnError = "error"
+	// RetryOnConnect . 连接失败时重试
+	RetryOnConnect = "connect"
+	// RetryOnTimeout . 超时重试
+	RetryOnTimeout = "timeout"
+
+	// DefaultRetryBackoff . 默认退避时间(毫秒)
+	DefaultRetryBackoff = 25
+	// DefaultRetryMaxBackoff . 默认最大退避时间(毫秒)
+	DefaultRetryMaxBackoff = 250
+)
+
+// RetryPolicy . 重试策略 可以设置在 Node 或 RouteInfo 上, Node 优先
+type RetryPolicy struct {
+	// 最大尝试次数 包含第一次请求
+	MaxAttempts int `json:"maxAttempts"`
+	// 触发重试的错误 error|connect|timeout, 为空时为 error
+	RetryOn []string `json:"retryOn"`
+	// 触发重试的状态码
+	RetryStatus []int `json:"retryStatus"`
+	// 是否重试非幂等的请求 默认只重试 GET HEAD OPTIONS PUT DELETE TRACE
+	AllMethods bool `json:"allMethods"`
+	// 退避时间(毫秒) 每次重试翻倍
+	Backoff int64 `json:"backoff"`
+	// 最大退避时间(毫秒)
+	MaxBackoff int64 `json:"maxBackoff"`
+}
+
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+	"TRACE":   true,
+}
+
+// retryPolicy . 获取节点的重试策略
+func (node Node) retryPolicy(routeInfo RouteInfo) *RetryPolicy {
+	if node.Retry != nil {
+		return node.Retry
+	}
+	return routeInfo.Retry
+}
+
+// attempts . 允许的尝试次数
+func (policy *RetryPolicy) attempts(method string) int {
+	if policy == nil || policy.MaxAttempts < 2 {
+		return 1
+	}
+	if !policy.AllMethods && !idempotentMethods[method] {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+// retryable . 请求结果是否需要重试
+func (policy *RetryPolicy) retryable(status int, err error) bool {
+	if err == nil {
+		for i, l := 0, len(policy.RetryStatus); i < l; i++ {
+			if policy.RetryStatus[i] == status {
+				return true
+			}
+		}
+		return false
+	}
+	if len(policy.RetryOn) == 0 {
+		return true
+	}
+	for i, l := 0, len(policy.RetryOn); i < l; i++ {
+		switch policy.RetryOn[i] {
+		case RetryOnError:
+			return true
+		case RetryOnConnect:
+			if isConnectError(err) {
+				return true
+			}
+		case RetryOnTimeout:
+			if isTimeout(err) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// backoff . 第 attempt 次请求失败后的等待时间, 在 [d/2, d) 之间随机
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff, maxBackoff := policy.Backoff, policy.MaxBackoff
+	if backoff < 1 {
+		backoff = DefaultRetryBackoff
+	}
+	if maxBackoff < backoff {
+		maxBackoff = DefaultRetryMaxBackoff
+		if maxBackoff < backoff {
+			maxBackoff = backoff
+		}
+	}
+	d := time.Duration(backoff) * time.Millisecond
+	for i := 1; i < attempt && d < time.Duration(maxBackoff)*time.Millisecond; i++ {
+		d *= 2
+	}
+	if max := time.Duration(maxBackoff) * time.Millisecond; d > max {
+		d = max
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// 建立连接阶段的错误
+func isConnectError(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *net.OpError:
+			return e.Op == "dial"
+		case interface{ Unwrap() error }:
+			if err = e.Unwrap(); err == nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+}
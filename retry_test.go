@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var policy *RetryPolicy
+	if policy.attempts("GET") != 1 {
+		t.Fatal("nil policy should not retry")
+	}
+	policy = &RetryPolicy{MaxAttempts: 3, RetryStatus: []int{503}, Backoff: 10, MaxBackoff: 30}
+	if policy.attempts("POST") != 1 || policy.attempts("GET") != 3 {
+		t.Fatal("only idempotent methods should be retried")
+	}
+	if !policy.retryable(503, nil) || policy.retryable(500, nil) {
+		t.Fatal("unexpected retryable status")
+	}
+	for attempt, max := range map[int]time.Duration{1: 10, 2: 20, 3: 30, 5: 30} {
+		if d := policy.backoff(attempt); d < max*time.Millisecond/2 || d > max*time.Millisecond {
+			t.Fatalf("attempt %d backoff %s out of range", attempt, d)
+		}
+	}
+}
+
+func TestNode_Retry(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ok.Close()
+
+	engine := New()
+	cluster := &Cluster{Name: "retry", LoadBalance: BalanceRoundRobin}
+	if err := engine.AddCluster(cluster); err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []*httptest.Server{unavailable, ok} {
+		cluster.Add(&Backend{Addr: strings.TrimPrefix(server.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 1})
+	}
+	node := Node{Attr: "data", Cluster: "retry", Retry: &RetryPolicy{MaxAttempts: 2, RetryStatus: []int{503}, Backoff: 1}}
+	for i := 0; i < 2; i++ {
+		ctx := engine.allocateContext()
+		ctx.reset()
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+		ctx.routeInfo = RouteInfo{Method: "GET"}
+		ctx.collect(node.Do(ctx))
+		if string(ctx.responses[0].Response) != `{"ok":true}` {
+			t.Fatalf("unexpected response %s", ctx.responses[0].Response)
+		}
+		last := ctx.ExecInfoGroup[len(ctx.ExecInfoGroup)-1]
+		if last.Status != 200 || last.Attempt != len(ctx.ExecInfoGroup) {
+			t.Fatalf("unexpected exec info %+v", ctx.ExecInfoGroup)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"regexp"
+	"strings"
 	"sync"
 )
 
@@ -9,24 +10,44 @@ type (
 	RouteTable struct {
 		m      *sync.RWMutex
 		tables []RouteInfo
-		table  []*RouteGroup
+		// 按域名划分的路由, "" 为默认域名
+		domains map[string]RouteGroups
 	}
 	RouteInfo struct {
 		Name   string `json:"name"`
 		Method string `json:"method"`
 		URL    string `json:"url"`
+		// 域名 支持 www.example.com | *.example.com, 为空时作为默认路由
 		Domain string `json:"domain"`
 		// 路由前操作
 		Handlers  []string `json:"handlers"`
 		NodeGroup []Node   `json:"nodeGroup"`
+		// 透传模式 只使用第一个节点, 原样转发请求与响应
+		Passthrough bool `json:"passthrough"`
+		// 流式转发 在透传模式的基础上边读边写并立即刷新, 用于 SSE 长轮询 大文件下载
+		Stream bool `json:"stream"`
+		// 合并节点时状态码的计算方式 worst|first|always-200, 默认 always-200
+		StatusPolicy string `json:"statusPolicy"`
+		// 转发给客户端的响应头 为空时使用 DefaultResponseHeaders
+		ResponseHeaders []string `json:"responseHeaders"`
+		// 整体超时时间(毫秒) 0 为不限制
+		Timeout int64 `json:"timeout"`
+		// WebSocket 连接空闲超时时间(毫秒) 默认 DefaultIdleTimeoutInMilliseconds
+		IdleTimeout int64 `json:"idleTimeout"`
+		// 重试策略 节点未设置时使用
+		Retry *RetryPolicy `json:"retry,omitempty"`
 
 		handles HandlesChain
+		graph   *nodeGraph
 	}
 	RouteGroup struct {
 		Method string
 		mtx    *sync.RWMutex
 		routes []RouteInfo
+		root   *routeNode
 	}
+	// RouteGroups . 单个域名下按 Method 划分的路由
+	RouteGroups []*RouteGroup
 )
 
 var methods = []string{"GET", "POST", "DELETE", "PUT", "PATCH", "HEAD", "OPTIONS", "CONNECT", "TRACE"}
@@ -34,91 +55,257 @@ var methods = []string{"GET", "POST", "DELETE", "PUT", "PATCH", "HEAD", "OPTIONS
 // NewRouteTable . 路由表
 func NewRouteTable() *RouteTable {
 	routeTable := &RouteTable{
-		m:      &sync.RWMutex{},
-		tables: make([]RouteInfo, 0),
+		m:       &sync.RWMutex{},
+		tables:  make([]RouteInfo, 0),
+		domains: make(map[string]RouteGroups),
 	}
+	routeTable.domains[""] = newRouteGroups()
+	return routeTable
+}
+
+func newRouteGroups() RouteGroups {
 	num := len(methods)
-	routeTable.table = make([]*RouteGroup, num)
+	groups := make(RouteGroups, num)
 	for i := 0; i < num; i++ {
-		routeTable.table[i] = &RouteGroup{
+		groups[i] = &RouteGroup{
 			Method: methods[i],
 			mtx:    &sync.RWMutex{},
 			routes: make([]RouteInfo, 0),
+			root:   newRouteNode(""),
 		}
 	}
-	return routeTable
+	return groups
 }
 
 // Get . 获取规则
-func (table *RouteTable) Get(method, url string) (has bool, routeInfo RouteInfo) {
-	for i, l := 0, len(methods); i < l; i++ {
-		if table.table[i].Method == method {
-			return table.table[i].Get(url)
+// 依次匹配 精确域名 -> 通配域名(由具体到宽泛) -> 默认域名
+func (table *RouteTable) Get(host, method, url string) (has bool, routeInfo RouteInfo, params PathParams) {
+	candidates := domainCandidates(NormalizeDomain(host))
+	for i, l := 0, len(candidates); i < l; i++ {
+		table.m.RLock()
+		groups, ok := table.domains[candidates[i]]
+		table.m.RUnlock()
+		if !ok {
+			continue
+		}
+		group := groups.get(method)
+		if group == nil {
+			return false, routeInfo, nil
+		}
+		if has, routeInfo, params = group.Get(url); has {
+			return
 		}
 	}
-	return false, routeInfo
+	return false, routeInfo, nil
 }
 
 // Add . 增加路由
 func (table *RouteTable) Add(routeInfo RouteInfo) (err error) {
-	routeInfo = routeInfo.initRegexp()
-	for i, l := 0, len(methods); i < l; i++ {
-		if table.table[i].Method == routeInfo.Method {
-			if table.table[i].indexOf(routeInfo.URL) != -1 {
-				return APIAlreadyExist
-			}
-			table.table[i].mtx.Lock()
-			table.table[i].routes = append(table.table[i].routes, routeInfo)
-			table.table[i].mtx.Unlock()
+	if routeInfo, err = routeInfo.prepare(); err != nil {
+		return err
+	}
+	group := table.group(routeInfo.Domain, routeInfo.Method, true)
+	if group == nil {
+		return UnknowableMethod
+	}
+	return group.add(routeInfo)
+}
+
+// Remove . 删除路由
+func (table *RouteTable) Remove(domain, method, url string) (err error) {
+	if !isMethod(method) {
+		return UnknowableMethod
+	}
+	group := table.group(NormalizeDomain(domain), method, false)
+	if group == nil {
+		return APINotFound
+	}
+	return group.remove(url)
+}
+
+// Update . 更新路由
+// 域名或 Method 发生变化时, 先加入新的分组, 成功后再从原分组移除
+func (table *RouteTable) Update(domain, method, url string, routeInfo RouteInfo) (err error) {
+	if routeInfo, err = routeInfo.prepare(); err != nil {
+		return err
+	}
+	target := table.group(routeInfo.Domain, routeInfo.Method, true)
+	if target == nil {
+		return UnknowableMethod
+	}
+	source := table.group(NormalizeDomain(domain), method, false)
+	if source != nil && source != target {
+		// 新分组冲突时原路由保持不变
+		if err = target.upsert(routeInfo.URL, routeInfo); err != nil {
+			return err
+		}
+		source.remove(url)
+		return nil
+	}
+	return target.upsert(url, routeInfo)
+}
+
+// 获取域名下指定 Method 的路由分组
+func (table *RouteTable) group(domain, method string, create bool) *RouteGroup {
+	if !isMethod(method) {
+		return nil
+	}
+	table.m.RLock()
+	groups, ok := table.domains[domain]
+	table.m.RUnlock()
+	if !ok {
+		if !create {
 			return nil
 		}
+		table.m.Lock()
+		if groups, ok = table.domains[domain]; !ok {
+			groups = newRouteGroups()
+			table.domains[domain] = groups
+		}
+		table.m.Unlock()
 	}
-	return UnknowableMethod
+	return groups.get(method)
 }
 
-// Remove . 删除路由
-func (table *RouteTable) Remove(method, url string) (err error) {
-	for i, l := 0, len(methods); i < l; i++ {
-		if table.table[i].Method == method {
-			if index := table.table[i].indexOf(url); index != -1 {
-				table.table[i].mtx.Lock()
-				table.table[i].routes = append(table.table[i].routes[:index], table.table[i].routes[index+1:]...)
-				table.table[i].mtx.Unlock()
-				return nil
-			}
-			return APINotFound
+func (groups RouteGroups) get(method string) *RouteGroup {
+	for i, l := 0, len(groups); i < l; i++ {
+		if groups[i].Method == method {
+			return groups[i]
 		}
 	}
-	return UnknowableMethod
+	return nil
 }
 
-// Update . 更新路由
-func (table *RouteTable) Update(method, url string, routeInfo RouteInfo) (err error) {
-	routeInfo = routeInfo.initRegexp()
+func isMethod(method string) bool {
 	for i, l := 0, len(methods); i < l; i++ {
-		if table.table[i].Method == method {
-			if index := table.table[i].indexOf(url); index != -1 {
-				table.table[i].mtx.Lock()
-				table.table[i].routes[index] = routeInfo
-				table.table[i].mtx.Unlock()
-				return nil
-			}
-			table.table[i].mtx.Lock()
-			table.table[i].routes = append(table.table[i].routes, routeInfo)
-			table.table[i].mtx.Unlock()
-			return nil
+		if methods[i] == method {
+			return true
 		}
 	}
-	return UnknowableMethod
+	return false
 }
 
-// Get .
-func (r *RouteGroup) Get(url string) (has bool, routeInfo RouteInfo) {
+// NormalizeDomain . 统一域名格式 去掉端口与末尾的点, 转为小写
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if index := strings.LastIndexByte(domain, ':'); index != -1 && !strings.Contains(domain[index:], "]") {
+		domain = domain[:index]
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "*" {
+		return ""
+	}
+	return domain
+}
+
+// 校验域名 通配符只能出现在最左侧 例如 *.example.com
+func validDomain(domain string) (string, error) {
+	domain = NormalizeDomain(domain)
+	if index := strings.LastIndexByte(domain, '*'); index > 0 ||
+		(index == 0 && (!strings.HasPrefix(domain, "*.") || len(domain) < 3)) {
+		return domain, DomainNotValid
+	}
+	return domain, nil
+}
+
+// 候选域名 a.b.example.com => [a.b.example.com *.b.example.com *.example.com *.com ""]
+func domainCandidates(host string) []string {
+	candidates := make([]string, 0, 4)
+	if host != "" {
+		candidates = append(candidates, host)
+		for index := strings.IndexByte(host, '.'); index != -1; index = strings.IndexByte(host, '.') {
+			host = host[index+1:]
+			candidates = append(candidates, "*."+host)
+		}
+	}
+	return append(candidates, "")
+}
+
+// Get . 匹配路由并返回路径参数
+func (r *RouteGroup) Get(url string) (has bool, routeInfo RouteInfo, params PathParams) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	route, params := r.root.lookup(splitPath(url), nil)
+	if route == nil {
+		return false, routeInfo, nil
+	}
+	return true, *route, params
+}
+
+func (r *RouteGroup) add(routeInfo RouteInfo) error {
+	if r.indexOf(routeInfo.URL) != -1 {
+		return APIAlreadyExist
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if err := r.root.insert(routeInfo); err != nil {
+		return err
+	}
+	r.routes = append(r.routes, routeInfo)
+	return nil
+}
+
+func (r *RouteGroup) remove(url string) error {
+	index := r.indexOf(url)
+	if index == -1 {
+		return APINotFound
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.routes = append(r.routes[:index], r.routes[index+1:]...)
+	return r.rebuild()
+}
+
+// 替换 url 对应的路由, 不存在时新增
+func (r *RouteGroup) upsert(url string, routeInfo RouteInfo) (err error) {
 	index := r.indexOf(url)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	routes := make([]RouteInfo, len(r.routes), len(r.routes)+1)
+	copy(routes, r.routes)
 	if index != -1 {
-		return true, r.routes[index]
+		routes[index] = routeInfo
+	} else {
+		routes = append(routes, routeInfo)
+	}
+	previous := r.routes
+	r.routes = routes
+	if err = r.rebuild(); err != nil {
+		// 冲突时还原
+		r.routes = previous
+		r.rebuild()
+	}
+	return err
+}
+
+// 重建路由树, 调用方需持有写锁
+func (r *RouteGroup) rebuild() error {
+	root := newRouteNode("")
+	for i, l := 0, len(r.routes); i < l; i++ {
+		if err := root.insert(r.routes[i]); err != nil {
+			return err
+		}
+	}
+	r.root = root
+	return nil
+}
+
+// prepare . 校验路由配置并初始化 Add 和 Update 共用
+func (routeInfo RouteInfo) prepare() (_ RouteInfo, err error) {
+	routeInfo = routeInfo.initRegexp()
+	if routeInfo.Domain, err = validDomain(routeInfo.Domain); err != nil {
+		return routeInfo, err
+	}
+	if routeInfo.graph, err = newNodeGraph(routeInfo.NodeGroup); err != nil {
+		return routeInfo, err
+	}
+	if !validStatusPolicy(routeInfo.StatusPolicy) {
+		return routeInfo, StatusPolicyUnknowable
+	}
+	if !validFallback(routeInfo.NodeGroup) {
+		return routeInfo, FallbackNotValid
 	}
-	return false, routeInfo
+	return routeInfo, nil
 }
 
 func (routeInfo RouteInfo) initRegexp() RouteInfo {
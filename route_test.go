@@ -24,7 +24,7 @@ func TestRouteTable_Add(t *testing.T) {
 }
 
 func TestRouteTable_Update(t *testing.T) {
-    route.Update(RouteInfo{
+    route.Update("", "POST", "/login", RouteInfo{
         Name: "登录接口",
         Method:"POST",
         URL:"/login",
@@ -40,11 +40,122 @@ func TestRouteTable_Update(t *testing.T) {
 }
 
 func TestRouteTable_Get(t *testing.T) {
-    route.Get("POST", "/login")
+    route.Get("", "POST", "/login")
+}
+
+func TestRouteTable_Match(t *testing.T) {
+    table := NewRouteTable()
+    urls := []string{"/users", "/users/:id", "/users/:id/orders", "/users/new", "/static/*filepath"}
+    for _, url := range urls {
+        if err := table.Add(RouteInfo{Method: "GET", URL: url}); err != nil {
+            t.Fatalf("add %s: %v", url, err)
+        }
+    }
+    cases := []struct {
+        path   string
+        url    string
+        params PathParams
+    }{
+        {"/users", "/users", nil},
+        {"/users/new", "/users/new", nil},
+        {"/users/123", "/users/:id", PathParams{{"id", "123"}}},
+        {"/users/123/orders", "/users/:id/orders", PathParams{{"id", "123"}}},
+        {"/static/js/app.js", "/static/*filepath", PathParams{{"filepath", "js/app.js"}}},
+        {"/static/", "/static/*filepath", PathParams{{"filepath", ""}}},
+    }
+    for _, c := range cases {
+        has, routeInfo, params := table.Get("", "GET", c.path)
+        if !has || routeInfo.URL != c.url {
+            t.Fatalf("%s: want %s, got %v %s", c.path, c.url, has, routeInfo.URL)
+        }
+        if len(params) != len(c.params) {
+            t.Fatalf("%s: want params %v, got %v", c.path, c.params, params)
+        }
+        for i := range params {
+            if params[i] != c.params[i] {
+                t.Fatalf("%s: want params %v, got %v", c.path, c.params, params)
+            }
+        }
+    }
+    if has, _, _ := table.Get("", "GET", "/users/123/profile"); has {
+        t.Fatal("/users/123/profile should not match")
+    }
+    if err := table.Add(RouteInfo{Method: "GET", URL: "/users/:name"}); err != RouteConflict {
+        t.Fatalf("want RouteConflict, got %v", err)
+    }
+    if err := table.Add(RouteInfo{Method: "GET", URL: "/files/*path/raw"}); err != URLNotValid {
+        t.Fatalf("want URLNotValid, got %v", err)
+    }
+    table.Remove("", "GET", "/users/:id")
+    if has, _, _ := table.Get("", "GET", "/users/123"); has {
+        t.Fatal("/users/123 should not match after remove")
+    }
+    if has, _, _ := table.Get("", "GET", "/users/123/orders"); !has {
+        t.Fatal("/users/123/orders should still match")
+    }
+}
+
+func TestRouteTable_Domain(t *testing.T) {
+    table := NewRouteTable()
+    for _, domain := range []string{"", "api.example.com", "*.example.com", "*.shop.example.com"} {
+        if err := table.Add(RouteInfo{Name: domain, Method: "GET", URL: "/ping", Domain: domain}); err != nil {
+            t.Fatalf("add %s: %v", domain, err)
+        }
+    }
+    table.Add(RouteInfo{Name: "default-only", Method: "GET", URL: "/status"})
+    cases := []struct {
+        host string
+        url  string
+        name string
+    }{
+        {"api.example.com", "/ping", "api.example.com"},
+        {"API.Example.com:8080", "/ping", "api.example.com"},
+        {"www.example.com", "/ping", "*.example.com"},
+        {"a.shop.example.com", "/ping", "*.shop.example.com"},
+        {"example.org", "/ping", ""},
+        {"", "/ping", ""},
+        {"api.example.com", "/status", "default-only"},
+    }
+    for _, c := range cases {
+        has, routeInfo, _ := table.Get(c.host, "GET", c.url)
+        if !has || routeInfo.Name != c.name {
+            t.Fatalf("%s%s: want %q, got %v %q", c.host, c.url, c.name, has, routeInfo.Name)
+        }
+    }
+    if err := table.Add(RouteInfo{Method: "GET", URL: "/ping", Domain: "api.*.com"}); err != DomainNotValid {
+        t.Fatalf("want DomainNotValid, got %v", err)
+    }
+    table.Update("api.example.com", "GET", "/ping", RouteInfo{Name: "moved", Method: "GET", URL: "/ping", Domain: "m.example.com"})
+    if _, routeInfo, _ := table.Get("api.example.com", "GET", "/ping"); routeInfo.Name != "*.example.com" {
+        t.Fatalf("api.example.com should fall back to wildcard, got %q", routeInfo.Name)
+    }
+    if _, routeInfo, _ := table.Get("m.example.com", "GET", "/ping"); routeInfo.Name != "moved" {
+        t.Fatalf("m.example.com should match moved route, got %q", routeInfo.Name)
+    }
+    // 新分组冲突时保留原路由
+    table.Add(RouteInfo{Name: "b", Method: "GET", URL: "/users/:id", Domain: "b.example.com"})
+    table.Add(RouteInfo{Name: "c", Method: "GET", URL: "/users/:name", Domain: "c.example.com"})
+    if err := table.Update("c.example.com", "GET", "/users/:name", RouteInfo{Name: "c", Method: "GET", URL: "/users/:name", Domain: "b.example.com"}); err != RouteConflict {
+        t.Fatalf("want RouteConflict, got %v", err)
+    }
+    if _, routeInfo, _ := table.Get("c.example.com", "GET", "/users/gopher"); routeInfo.Name != "c" {
+        t.Fatalf("route should be kept when update fails, got %q", routeInfo.Name)
+    }
+}
+
+func TestNode_Rewrite(t *testing.T) {
+    ctx := &Context{Params: PathParams{{"id", "12 3"}, {"rest", "a/b"}}}
+    node := Node{Rewrite: "/user/{id}/orders/{rest}"}
+    if uri := node.rewrite(ctx, nil); uri != "/user/12%203/orders/a/b" {
+        t.Fatalf("unexpected rewrite %s", uri)
+    }
+    if uri := node.rewrite(ctx, map[string]string{"id": "9"}); uri != "/user/9/orders/a/b" {
+        t.Fatalf("unexpected rewrite %s", uri)
+    }
 }
 
 func TestRouteTable_Remove(t *testing.T) {
-    route.Remove("POST", "login")
+    route.Remove("", "POST", "login")
 }
 
 func TestRouteTable_Add2(t *testing.T) {
@@ -0,0 +1,108 @@
+package gateway
+
+import "net/http"
+
+const (
+	// StatusWorst . 合并节点中最大的状态码
+	StatusWorst = "worst"
+	// StatusFirst . 按 NodeGroup 顺序第一个节点的状态码
+	StatusFirst = "first"
+	// StatusAlways200 . 总是返回 200
+	StatusAlways200 = "always-200"
+)
+
+// DefaultResponseHeaders . 默认转发给客户端的后端服务响应头
+var DefaultResponseHeaders = []string{
+	"Set-Cookie",
+	"Cache-Control",
+	"ETag",
+	"Last-Modified",
+	"Expires",
+	"Vary",
+	"Location",
+}
+
+// 合并路由未设置时使用 兼容原有的返回
+const defaultStatusPolicy = StatusAlways200
+
+func validStatusPolicy(policy string) bool {
+	switch policy {
+	case "", StatusWorst, StatusFirst, StatusAlways200:
+		return true
+	}
+	return false
+}
+
+// status . 根据节点的状态码计算返回给客户端的状态码
+// 单个节点时直接使用后端服务的状态码, 没有收到后端服务响应以及使用了默认值的节点不参与计算
+func (routeInfo RouteInfo) status(responses []combineResponse) int {
+	policy := routeInfo.StatusPolicy
+	if len(responses) == 1 {
+		policy = StatusFirst
+	} else if policy == "" {
+		policy = defaultStatusPolicy
+	}
+	status := 0
+	switch policy {
+	case StatusWorst:
+		for i, l := 0, len(responses); i < l; i++ {
+			if responses[i].recovered() {
+				continue
+			}
+			if responses[i].Status > status {
+				status = responses[i].Status
+			}
+		}
+	case StatusFirst:
+		for i, l := 0, len(responses); i < l && status == 0; i++ {
+			if !responses[i].recovered() {
+				status = responses[i].Status
+			}
+		}
+	}
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+// 1xx 204 304 不允许有响应体
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent:
+		return false
+	case status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// responseHeaders . 允许转发的响应头
+func (routeInfo RouteInfo) responseHeaders() []string {
+	if len(routeInfo.ResponseHeaders) > 0 {
+		return routeInfo.ResponseHeaders
+	}
+	return DefaultResponseHeaders
+}
+
+// writeHeaders . 转发节点的响应头 Set-Cookie 合并所有节点, 其他头部使用第一个返回的节点
+func (c *Context) writeHeaders(responses []combineResponse) {
+	allowed := c.routeInfo.responseHeaders()
+	header := c.Writer.Header()
+	for i, l := 0, len(allowed); i < l; i++ {
+		key := http.CanonicalHeaderKey(allowed[i])
+		for j, k := 0, len(responses); j < k; j++ {
+			values := responses[j].Header[key]
+			if len(values) == 0 {
+				continue
+			}
+			if key != "Set-Cookie" {
+				header[key] = append([]string(nil), values...)
+				break
+			}
+			header[key] = append(header[key], values...)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteInfo_Status(t *testing.T) {
+	responses := []combineResponse{{Status: 0}, {Status: 404}, {Status: 503}, {Status: 200}}
+	for policy, expect := range map[string]int{
+		"":              200,
+		StatusAlways200: 200,
+		StatusFirst:     404,
+		StatusWorst:     503,
+	} {
+		if status := (RouteInfo{StatusPolicy: policy}).status(responses); status != expect {
+			t.Fatalf("policy %q expect %d got %d", policy, expect, status)
+		}
+	}
+	if status := (RouteInfo{}).status(responses[1:2]); status != 404 {
+		t.Fatalf("single node should forward status, got %d", status)
+	}
+	if status := (RouteInfo{}).status(responses[:1]); status != 200 {
+		t.Fatalf("node without response should be 200, got %d", status)
+	}
+}
+
+func TestProxy_StatusAndHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: r.URL.Path[1:], Value: "1"})
+		w.Header().Set("ETag", r.URL.Path)
+		w.Header().Set("X-Internal", "secret")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.AddCluster(&Cluster{Name: "status"})
+	_, cluster := engine.Cluster("status")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	engine.Route(RouteInfo{Method: "GET", URL: "/single", NodeGroup: []Node{{Cluster: "status", Rewrite: "/missing"}}})
+	engine.Route(RouteInfo{Method: "GET", URL: "/combine", StatusPolicy: StatusWorst, NodeGroup: []Node{
+		{Attr: "a", Cluster: "status", Rewrite: "/a"},
+		{Attr: "b", Cluster: "status", Rewrite: "/missing"},
+	}})
+	if err := engine.Route(RouteInfo{Method: "GET", URL: "/unknown", StatusPolicy: "best"}); err != StatusPolicyUnknowable {
+		t.Fatalf("expect %v got %v", StatusPolicyUnknowable, err)
+	}
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/single", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "/missing" || w.Header().Get("X-Internal") != "" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/combine", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "/a" || len(w.Header()["Set-Cookie"]) != 2 {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+}
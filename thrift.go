@@ -0,0 +1,696 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// thrift 严格模式的版本号
+	thriftVersion1 = 0x80010000
+
+	thriftCallMessage      = 1
+	thriftReplyMessage     = 2
+	thriftExceptionMessage = 3
+
+	// 单个字符串 容器或 frame 的最大长度
+	maxThriftSize = 64 << 20
+)
+
+// TApplicationException 的字段
+var thriftApplicationException = []*thriftField{
+	{id: 1, name: "message", typ: &thriftType{name: "string"}},
+	{id: 2, name: "type", typ: &thriftType{name: "i32"}},
+}
+
+// thriftCall . 转换后的 thrift 请求
+type thriftCall struct {
+	method *thriftMethod
+	scope  thriftScope
+	// 参数结构体 不包含消息头
+	args []byte
+}
+
+// thriftRequest . 参数按 ToName 转为方法的参数 不支持 oneway 方法
+func (node Node) thriftRequest(ctx *Context, parseParam ParseParam) (*thriftCall, error) {
+	method, scope, err := ctx.engine.thriftIDLs.method(node.ThriftMethod)
+	if err != nil {
+		return nil, err
+	}
+	if method.oneway {
+		return nil, ThriftMethodNotFound
+	}
+	var w thriftWriter
+	if err := scope.writeStruct(&w, method.args, parseParam.message()); err != nil {
+		return nil, ThriftMessageNotValid
+	}
+	return &thriftCall{method: method, scope: scope, args: w.Bytes()}, nil
+}
+
+// callThrift . 通过连接池请求一次 thrift 后端服务, 结果写入 response
+func (node Node) callThrift(ctx *Context, cluster *Cluster, backend *Backend, parseParam ParseParam, attempt int, response *combineResponse) (status int, err error) {
+	execInfo := ExecInfo{
+		BackendADDR: backend.Addr,
+		BackendURI:  "thrift://" + backend.Addr + "/" + node.ThriftMethod,
+		Attempt:     attempt,
+		Success:     true,
+	}
+	defer func() {
+		response.execInfoGroup = append(response.execInfoGroup, execInfo)
+	}()
+	response.Response, response.Error = nil, nil
+	response.Status, response.Header = 0, nil
+	response.encoded = true
+	// 客户端断开连接或超时时取消请求
+	timeoutCtx, cancel := context.WithTimeout(ctx.base(), node.timeout(ctx, backend))
+	defer cancel()
+	atomic.AddUint64(&backend.Waiting, 1)
+	defer atomic.AddUint64(&backend.Waiting, ^uint64(-step-1))
+	now := time.Now()
+	if backend.thrift == nil {
+		err = fmt.Errorf("%s is not a thrift backend", backend.Addr)
+	} else {
+		status, response.Response, err = parseParam.thrift.do(timeoutCtx, backend.thrift)
+	}
+	execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+	if err != nil && ctx.Err() != nil {
+		backend.abandon()
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		response.Error = ctx.abortError()
+		return 0, err
+	}
+	backend.observe(time.Since(now), err != nil || status >= http.StatusInternalServerError)
+	cluster.report(backend, status, err)
+	if err != nil {
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		response.Error = backendError(err)
+		return 0, err
+	}
+	execInfo.Status, response.Status = status, status
+	return status, nil
+}
+
+// do . 发送请求并解析响应 出错的连接不会放回连接池
+func (call *thriftCall) do(ctx context.Context, pool *thriftPool) (int, []byte, error) {
+	conn, err := pool.get(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			// 中断正在进行的读写
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	seqID := atomic.AddInt32(&pool.seqID, 1)
+	status, body, err := call.roundTrip(conn, pool.framed, seqID)
+	close(done)
+	// 等待退出后再放回连接池, 避免过期的 deadline 影响之后的请求
+	<-exited
+	if err != nil || ctx.Err() != nil {
+		conn.Close()
+		return status, body, err
+	}
+	conn.SetDeadline(time.Time{})
+	pool.put(conn)
+	return status, body, nil
+}
+
+func (call *thriftCall) roundTrip(conn net.Conn, framed bool, seqID int32) (int, []byte, error) {
+	var w thriftWriter
+	if framed {
+		w.writeI32(0)
+	}
+	version := uint32(thriftVersion1 | thriftCallMessage)
+	w.writeI32(int32(version))
+	w.writeString(call.method.name)
+	w.writeI32(seqID)
+	w.Write(call.args)
+	message := w.Bytes()
+	if framed {
+		binary.BigEndian.PutUint32(message, uint32(len(message)-4))
+	}
+	if _, err := conn.Write(message); err != nil {
+		return 0, nil, err
+	}
+	r := &thriftReader{r: bufio.NewReader(conn)}
+	if framed {
+		size, err := r.readI32()
+		if err != nil {
+			return 0, nil, err
+		}
+		if size < 0 || size > maxThriftSize {
+			return 0, nil, fmt.Errorf("thrift frame size %d not valid", size)
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(r.r, frame); err != nil {
+			return 0, nil, err
+		}
+		r.r = bytes.NewReader(frame)
+	}
+	name, typ, id, err := r.readMessageBegin()
+	if err != nil {
+		return 0, nil, err
+	}
+	if name != call.method.name || id != seqID {
+		return 0, nil, fmt.Errorf("thrift reply %s:%d does not match %s:%d", name, id, call.method.name, seqID)
+	}
+	return call.decode(r, typ)
+}
+
+// decode . 响应转为 JSON
+// TApplicationException 返回 500 {"code": 异常类型, "message": 错误信息}
+// 声明的异常返回 400 {异常字段名: 异常内容}
+func (call *thriftCall) decode(r *thriftReader, typ byte) (int, []byte, error) {
+	switch typ {
+	case thriftExceptionMessage:
+		exception, err := call.scope.readStruct(r, thriftApplicationException)
+		if err != nil {
+			return 0, nil, err
+		}
+		b, _ := json.Marshal(H{"code": exception["type"], "message": exception["message"]})
+		return http.StatusInternalServerError, b, nil
+	case thriftReplyMessage:
+	default:
+		return 0, nil, fmt.Errorf("thrift message type %d not valid", typ)
+	}
+	fields := make([]*thriftField, 0, len(call.method.throws)+1)
+	if !call.method.void {
+		fields = append(fields, &thriftField{id: 0, name: "success", typ: call.method.result})
+	}
+	fields = append(fields, call.method.throws...)
+	result, err := call.scope.readStruct(r, fields)
+	if err != nil {
+		return 0, nil, err
+	}
+	if success, ok := result["success"]; ok {
+		// 字符串同样编码为 JSON, 避免 "123" 等内容被当作其他类型解析
+		b, err := json.Marshal(success)
+		return http.StatusOK, b, err
+	}
+	if len(result) > 0 {
+		b, err := json.Marshal(result)
+		return http.StatusBadRequest, b, err
+	}
+	if !call.method.void {
+		return 0, nil, fmt.Errorf("thrift %s returns no result", call.method.name)
+	}
+	return http.StatusOK, []byte("{}"), nil
+}
+
+// thriftPool . thrift 后端服务的连接池 只保留空闲连接, 不限制连接总数
+type thriftPool struct {
+	addr        string
+	framed      bool
+	maxIdle     int
+	idleTimeout time.Duration
+	dialer      *net.Dialer
+	seqID       int32
+
+	mtx    sync.Mutex
+	idle   []thriftConn
+	closed bool
+}
+
+type thriftConn struct {
+	net.Conn
+	since time.Time
+}
+
+func newThriftPool(addr string, setting TransportSetting) *thriftPool {
+	return &thriftPool{
+		addr:        addr,
+		framed:      setting.ThriftFramed,
+		maxIdle:     setting.MaxIdleConnsPerHost,
+		idleTimeout: time.Duration(setting.IdleConnTimeout) * time.Second,
+		dialer: &net.Dialer{
+			Timeout:   time.Duration(setting.DialTimeout) * time.Millisecond,
+			KeepAlive: 30 * time.Second,
+		},
+	}
+}
+
+// get . 优先使用最近放回的空闲连接, 超过空闲时间的连接直接关闭
+func (pool *thriftPool) get(ctx context.Context) (net.Conn, error) {
+	pool.mtx.Lock()
+	for len(pool.idle) > 0 {
+		conn := pool.idle[len(pool.idle)-1]
+		pool.idle = pool.idle[:len(pool.idle)-1]
+		if time.Since(conn.since) < pool.idleTimeout {
+			pool.mtx.Unlock()
+			return conn.Conn, nil
+		}
+		conn.Close()
+	}
+	pool.mtx.Unlock()
+	return pool.dialer.DialContext(ctx, "tcp", pool.addr)
+}
+
+func (pool *thriftPool) put(conn net.Conn) {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	if pool.closed || len(pool.idle) >= pool.maxIdle {
+		conn.Close()
+		return
+	}
+	pool.idle = append(pool.idle, thriftConn{Conn: conn, since: time.Now()})
+}
+
+// close . 关闭空闲连接 正在使用的连接用完后关闭
+func (pool *thriftPool) close() {
+	pool.mtx.Lock()
+	defer pool.mtx.Unlock()
+	pool.closed = true
+	for i := range pool.idle {
+		pool.idle[i].Close()
+	}
+	pool.idle = nil
+}
+
+// thriftWriter . binary 协议编码
+type thriftWriter struct {
+	bytes.Buffer
+}
+
+func (w *thriftWriter) writeI16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	w.Write(b[:])
+}
+
+func (w *thriftWriter) writeI32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	w.Write(b[:])
+}
+
+func (w *thriftWriter) writeI64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.Write(b[:])
+}
+
+func (w *thriftWriter) writeString(v string) {
+	w.writeI32(int32(len(v)))
+	w.WriteString(v)
+}
+
+// writeStruct . 按字段定义编码 JSON 对象, 未传的非字符串字段跳过
+func (scope thriftScope) writeStruct(w *thriftWriter, fields []*thriftField, obj map[string]interface{}) error {
+	for _, field := range fields {
+		val := obj[field.name]
+		id, err := thriftByte, error(nil)
+		if val != nil {
+			if id, err = scope.typeID(field.typ); err != nil {
+				return err
+			}
+			if str, ok := val.(string); ok && str == "" && id != thriftString {
+				val = nil
+			}
+		}
+		if val == nil {
+			if field.required {
+				return ThriftMessageNotValid
+			}
+			continue
+		}
+		w.WriteByte(id)
+		w.writeI16(field.id)
+		if err := scope.writeValue(w, field.typ, val); err != nil {
+			return err
+		}
+	}
+	return w.WriteByte(thriftStop)
+}
+
+func (scope thriftScope) writeValue(w *thriftWriter, typ *thriftType, val interface{}) error {
+	typ = scope.resolve(typ)
+	switch typ.name {
+	case "bool":
+		b, ok := val.(bool)
+		if str, isString := val.(string); isString {
+			v, err := strconv.ParseBool(str)
+			if err != nil {
+				return err
+			}
+			b, ok = v, true
+		}
+		if !ok {
+			return ThriftMessageNotValid
+		}
+		if b {
+			return w.WriteByte(1)
+		}
+		return w.WriteByte(0)
+	case "byte", "i8":
+		n, err := thriftInt(val, 8)
+		w.WriteByte(byte(n))
+		return err
+	case "i16":
+		n, err := thriftInt(val, 16)
+		w.writeI16(int16(n))
+		return err
+	case "i32":
+		n, err := thriftInt(val, 32)
+		w.writeI32(int32(n))
+		return err
+	case "i64":
+		n, err := thriftInt(val, 64)
+		w.writeI64(n)
+		return err
+	case "double":
+		f, err := strconv.ParseFloat(jsonString(val), 64)
+		w.writeI64(int64(math.Float64bits(f)))
+		return err
+	case "string", "binary":
+		if str, ok := val.(string); ok {
+			w.writeString(str)
+		} else {
+			w.writeString(jsonString(val))
+		}
+		return nil
+	case "list", "set":
+		list, ok := val.([]interface{})
+		if !ok {
+			list = []interface{}{val}
+		}
+		id, err := scope.typeID(typ.elem)
+		if err != nil {
+			return err
+		}
+		w.WriteByte(id)
+		w.writeI32(int32(len(list)))
+		for i := range list {
+			if err := scope.writeValue(w, typ.elem, list[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "map":
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return ThriftMessageNotValid
+		}
+		keyID, err := scope.typeID(typ.key)
+		if err != nil {
+			return err
+		}
+		valID, err := scope.typeID(typ.elem)
+		if err != nil {
+			return err
+		}
+		w.WriteByte(keyID)
+		w.WriteByte(valID)
+		w.writeI32(int32(len(obj)))
+		for key, v := range obj {
+			if err := scope.writeValue(w, typ.key, key); err != nil {
+				return err
+			}
+			if err := scope.writeValue(w, typ.elem, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// 枚举可以使用名称或数值
+	if values := scope.enum(typ.name); values != nil {
+		if str, ok := val.(string); ok {
+			if n, ok := values[str]; ok {
+				w.writeI32(int32(n))
+				return nil
+			}
+		}
+		n, err := thriftInt(val, 32)
+		w.writeI32(int32(n))
+		return err
+	}
+	if def := scope.structDef(typ.name); def != nil {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return ThriftMessageNotValid
+		}
+		return scope.writeStruct(w, def.fields, obj)
+	}
+	return ThriftMessageNotValid
+}
+
+// thriftInt . 数字或数字字符串转为整数 超出范围时返回错误
+func thriftInt(val interface{}, bits int) (int64, error) {
+	switch v := val.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, ThriftMessageNotValid
+		}
+		return strconv.ParseInt(strconv.FormatFloat(v, 'f', -1, 64), 10, bits)
+	case json.Number:
+		return strconv.ParseInt(v.String(), 10, bits)
+	case string:
+		return strconv.ParseInt(v, 10, bits)
+	case int8, int16, int32, int64, int:
+		return strconv.ParseInt(fmt.Sprint(v), 10, bits)
+	}
+	return 0, ThriftMessageNotValid
+}
+
+// thriftReader . binary 协议解码
+type thriftReader struct {
+	r   io.Reader
+	buf [8]byte
+}
+
+func (r *thriftReader) read(n int) ([]byte, error) {
+	_, err := io.ReadFull(r.r, r.buf[:n])
+	return r.buf[:n], err
+}
+
+func (r *thriftReader) readByte() (byte, error) {
+	b, err := r.read(1)
+	return b[0], err
+}
+
+func (r *thriftReader) readI16() (int16, error) {
+	b, err := r.read(2)
+	return int16(binary.BigEndian.Uint16(b)), err
+}
+
+func (r *thriftReader) readI32() (int32, error) {
+	b, err := r.read(4)
+	return int32(binary.BigEndian.Uint32(b)), err
+}
+
+func (r *thriftReader) readI64() (int64, error) {
+	b, err := r.read(8)
+	return int64(binary.BigEndian.Uint64(b)), err
+}
+
+func (r *thriftReader) readBytes() ([]byte, error) {
+	size, err := r.readI32()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > maxThriftSize {
+		return nil, fmt.Errorf("thrift size %d not valid", size)
+	}
+	b := make([]byte, size)
+	_, err = io.ReadFull(r.r, b)
+	return b, err
+}
+
+// readMessageBegin . 兼容严格与非严格模式的消息头
+func (r *thriftReader) readMessageBegin() (name string, typ byte, seqID int32, err error) {
+	size, err := r.readI32()
+	if err != nil {
+		return
+	}
+	if size < 0 {
+		if uint32(size)&0xffff0000 != thriftVersion1 {
+			return "", 0, 0, fmt.Errorf("thrift version %x not valid", uint32(size))
+		}
+		typ = byte(size)
+		b, err := r.readBytes()
+		if err != nil {
+			return "", 0, 0, err
+		}
+		name = string(b)
+	} else {
+		if size > maxThriftSize {
+			return "", 0, 0, fmt.Errorf("thrift size %d not valid", size)
+		}
+		b := make([]byte, size)
+		if _, err = io.ReadFull(r.r, b); err != nil {
+			return
+		}
+		name = string(b)
+		if typ, err = r.readByte(); err != nil {
+			return
+		}
+	}
+	seqID, err = r.readI32()
+	return
+}
+
+// readStruct . 按字段定义解码为 JSON 对象, 未定义的字段读取后丢弃
+func (scope thriftScope) readStruct(r *thriftReader, fields []*thriftField) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if id == thriftStop {
+			return obj, nil
+		}
+		fieldID, err := r.readI16()
+		if err != nil {
+			return nil, err
+		}
+		var field *thriftField
+		for _, f := range fields {
+			if f.id == fieldID {
+				field = f
+				break
+			}
+		}
+		var typ *thriftType
+		if field != nil {
+			if expected, err := scope.typeID(field.typ); err == nil && expected == id {
+				typ = field.typ
+			}
+		}
+		val, err := scope.readValue(r, id, typ)
+		if err != nil {
+			return nil, err
+		}
+		if typ != nil {
+			obj[field.name] = val
+		}
+	}
+}
+
+// readValue . typ 为空时按协议中的类型读取
+func (scope thriftScope) readValue(r *thriftReader, id byte, typ *thriftType) (interface{}, error) {
+	if typ != nil {
+		typ = scope.resolve(typ)
+	}
+	switch id {
+	case thriftBool:
+		b, err := r.readByte()
+		return b != 0, err
+	case thriftByte:
+		b, err := r.readByte()
+		return int8(b), err
+	case thriftI16:
+		return r.readI16()
+	case thriftI32:
+		n, err := r.readI32()
+		if err == nil && typ != nil {
+			// 枚举返回名称
+			for name, value := range scope.enum(typ.name) {
+				if value == int64(n) {
+					return name, nil
+				}
+			}
+		}
+		return n, err
+	case thriftI64:
+		return r.readI64()
+	case thriftDouble:
+		n, err := r.readI64()
+		return math.Float64frombits(uint64(n)), err
+	case thriftString:
+		b, err := r.readBytes()
+		if typ != nil && typ.name == "binary" {
+			return b, err
+		}
+		return string(b), err
+	case thriftStruct:
+		var fields []*thriftField
+		if typ != nil {
+			if def := scope.structDef(typ.name); def != nil {
+				fields = def.fields
+			}
+		}
+		return scope.readStruct(r, fields)
+	case thriftMap:
+		keyID, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		valID, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.readI32()
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 || size > maxThriftSize {
+			return nil, fmt.Errorf("thrift size %d not valid", size)
+		}
+		var keyType, valType *thriftType
+		if typ != nil {
+			keyType, valType = typ.key, typ.elem
+		}
+		obj := make(map[string]interface{})
+		for i := int32(0); i < size; i++ {
+			key, err := scope.readValue(r, keyID, keyType)
+			if err != nil {
+				return nil, err
+			}
+			val, err := scope.readValue(r, valID, valType)
+			if err != nil {
+				return nil, err
+			}
+			obj[fmt.Sprint(key)] = val
+		}
+		return obj, nil
+	case thriftSet, thriftList:
+		elemID, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.readI32()
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 || size > maxThriftSize {
+			return nil, fmt.Errorf("thrift size %d not valid", size)
+		}
+		var elemType *thriftType
+		if typ != nil {
+			elemType = typ.elem
+		}
+		list := make([]interface{}, 0)
+		for i := int32(0); i < size; i++ {
+			val, err := scope.readValue(r, elemID, elemType)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("thrift type %d not valid", id)
+}
@@ -0,0 +1,516 @@
+package gateway
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// thrift 类型 id
+const (
+	thriftStop   byte = 0
+	thriftBool   byte = 2
+	thriftByte   byte = 3
+	thriftDouble byte = 4
+	thriftI16    byte = 6
+	thriftI32    byte = 8
+	thriftI64    byte = 10
+	thriftString byte = 11
+	thriftStruct byte = 12
+	thriftMap    byte = 13
+	thriftSet    byte = 14
+	thriftList   byte = 15
+)
+
+var thriftBaseTypes = map[string]byte{
+	"bool":   thriftBool,
+	"byte":   thriftByte,
+	"i8":     thriftByte,
+	"i16":    thriftI16,
+	"i32":    thriftI32,
+	"i64":    thriftI64,
+	"double": thriftDouble,
+	"string": thriftString,
+	"binary": thriftString,
+}
+
+type (
+	// ThriftIDLGroup . 已注册的 thrift IDL 用于调用 thrift 后端服务
+	ThriftIDLGroup struct {
+		rwMutex sync.RWMutex
+		idls    map[string]*thriftDocument
+	}
+	// ThriftIDLInfo . IDL 中包含的服务
+	ThriftIDLInfo struct {
+		Name     string   `json:"name"`
+		Services []string `json:"services"`
+	}
+
+	// thriftDocument . 解析后的 IDL 只保留调用需要的定义, 常量等会被忽略
+	thriftDocument struct {
+		typedefs map[string]*thriftType
+		enums    map[string]map[string]int64
+		structs  map[string]*thriftStructDef
+		services map[string]*thriftService
+	}
+	thriftType struct {
+		// 基础类型 容器类型 list|set|map 或者自定义类型的名称
+		name string
+		key  *thriftType
+		elem *thriftType
+	}
+	thriftField struct {
+		id       int16
+		name     string
+		typ      *thriftType
+		required bool
+	}
+	thriftStructDef struct {
+		name   string
+		fields []*thriftField
+	}
+	thriftService struct {
+		name    string
+		extends string
+		methods map[string]*thriftMethod
+	}
+	thriftMethod struct {
+		name    string
+		oneway  bool
+		void    bool
+		result  *thriftType
+		args    []*thriftField
+		throws  []*thriftField
+		service string
+	}
+	// thriftScope . 查找方法时 IDL 的快照, 自定义类型优先在方法所在的 IDL 中查找
+	thriftScope []*thriftDocument
+)
+
+// Add . 注册 IDL 同名的 IDL 会被替换
+func (group *ThriftIDLGroup) Add(name string, content string) error {
+	doc, err := parseThriftIDL(content)
+	if err != nil {
+		return err
+	}
+	group.rwMutex.Lock()
+	defer group.rwMutex.Unlock()
+	if group.idls == nil {
+		group.idls = make(map[string]*thriftDocument)
+	}
+	group.idls[name] = doc
+	return nil
+}
+
+// Remove . 移除 IDL
+func (group *ThriftIDLGroup) Remove(name string) error {
+	group.rwMutex.Lock()
+	defer group.rwMutex.Unlock()
+	if _, ok := group.idls[name]; !ok {
+		return ThriftIDLNotFound
+	}
+	delete(group.idls, name)
+	return nil
+}
+
+// IDLs . 所有的 IDL
+func (group *ThriftIDLGroup) IDLs() []ThriftIDLInfo {
+	group.rwMutex.RLock()
+	defer group.rwMutex.RUnlock()
+	infos := make([]ThriftIDLInfo, 0, len(group.idls))
+	for name, doc := range group.idls {
+		info := ThriftIDLInfo{Name: name, Services: make([]string, 0, len(doc.services))}
+		for service := range doc.services {
+			info.Services = append(info.Services, service)
+		}
+		sort.Strings(info.Services)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// method . 按 Service.method 查找方法 包括 extends 继承的方法
+func (group *ThriftIDLGroup) method(name string) (*thriftMethod, thriftScope, error) {
+	index := strings.LastIndexByte(name, '.')
+	if index == -1 {
+		return nil, nil, ThriftMethodNotFound
+	}
+	service, method := name[:index], name[index+1:]
+	group.rwMutex.RLock()
+	defer group.rwMutex.RUnlock()
+	for _, doc := range group.idls {
+		if _, ok := doc.services[service]; !ok {
+			continue
+		}
+		scope := thriftScope{doc}
+		for _, other := range group.idls {
+			if other != doc {
+				scope = append(scope, other)
+			}
+		}
+		// extends 最多查找 16 层, 避免循环继承
+		for depth := 0; depth < 16 && service != ""; depth++ {
+			def := scope.service(service)
+			if def == nil {
+				break
+			}
+			if m, ok := def.methods[method]; ok {
+				return m, scope, nil
+			}
+			service = def.extends
+		}
+		return nil, nil, ThriftMethodNotFound
+	}
+	return nil, nil, ThriftMethodNotFound
+}
+
+// 去掉 include 的前缀 types.User => User
+func thriftLocalName(name string) string {
+	if index := strings.LastIndexByte(name, '.'); index != -1 {
+		return name[index+1:]
+	}
+	return name
+}
+
+func (scope thriftScope) service(name string) *thriftService {
+	for _, doc := range scope {
+		if service, ok := doc.services[thriftLocalName(name)]; ok {
+			return service
+		}
+	}
+	return nil
+}
+
+// resolve . 展开 typedef
+func (scope thriftScope) resolve(typ *thriftType) *thriftType {
+	for depth := 0; depth < 16; depth++ {
+		if _, ok := thriftBaseTypes[typ.name]; ok || typ.key != nil || typ.elem != nil {
+			return typ
+		}
+		var next *thriftType
+		for _, doc := range scope {
+			if next = doc.typedefs[thriftLocalName(typ.name)]; next != nil {
+				break
+			}
+		}
+		if next == nil {
+			return typ
+		}
+		typ = next
+	}
+	return typ
+}
+
+func (scope thriftScope) structDef(name string) *thriftStructDef {
+	for _, doc := range scope {
+		if def, ok := doc.structs[thriftLocalName(name)]; ok {
+			return def
+		}
+	}
+	return nil
+}
+
+func (scope thriftScope) enum(name string) map[string]int64 {
+	for _, doc := range scope {
+		if values, ok := doc.enums[thriftLocalName(name)]; ok {
+			return values
+		}
+	}
+	return nil
+}
+
+// typeID . 类型在协议中的 id
+func (scope thriftScope) typeID(typ *thriftType) (byte, error) {
+	typ = scope.resolve(typ)
+	if id, ok := thriftBaseTypes[typ.name]; ok {
+		return id, nil
+	}
+	switch typ.name {
+	case "list":
+		return thriftList, nil
+	case "set":
+		return thriftSet, nil
+	case "map":
+		return thriftMap, nil
+	}
+	if scope.enum(typ.name) != nil {
+		return thriftI32, nil
+	}
+	if scope.structDef(typ.name) != nil {
+		return thriftStruct, nil
+	}
+	return 0, ThriftMessageNotValid
+}
+
+// thriftParser . 只解析 typedef enum struct union exception service, 其余定义跳过
+type thriftParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseThriftIDL(content string) (doc *thriftDocument, err error) {
+	tokens, ok := thriftTokens(content)
+	if !ok {
+		return nil, ThriftIDLNotValid
+	}
+	parser := &thriftParser{tokens: tokens}
+	doc = &thriftDocument{
+		typedefs: make(map[string]*thriftType),
+		enums:    make(map[string]map[string]int64),
+		structs:  make(map[string]*thriftStructDef),
+		services: make(map[string]*thriftService),
+	}
+	defer func() {
+		// 解析出错时 panic, 统一转为 ThriftIDLNotValid
+		if recover() != nil {
+			doc, err = nil, ThriftIDLNotValid
+		}
+	}()
+	for !parser.eof() {
+		switch keyword := parser.next(); keyword {
+		case "include", "cpp_include":
+			parser.next()
+		case "namespace":
+			parser.next()
+			parser.next()
+		case "const":
+			parser.parseType()
+			parser.next()
+			parser.expect("=")
+			parser.skipValue()
+		case "typedef":
+			typ := parser.parseType()
+			doc.typedefs[parser.next()] = typ
+		case "enum":
+			name := parser.next()
+			doc.enums[name] = parser.parseEnum()
+		case "struct", "union", "exception":
+			name := parser.next()
+			parser.expect("{")
+			doc.structs[name] = &thriftStructDef{name: name, fields: parser.parseFields("}")}
+		case "service":
+			service := parser.parseService()
+			doc.services[service.name] = service
+		case ";", ",":
+		default:
+			panic(keyword)
+		}
+		parser.skipAnnotations()
+	}
+	return doc, nil
+}
+
+// thriftTokens . 拆分为标识符 数字 字符串与符号, 忽略注释
+func thriftTokens(content string) ([]string, bool) {
+	tokens := make([]string, 0, len(content)/4)
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#' || strings.HasPrefix(content[i:], "//"):
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end == -1 {
+				return nil, false
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(content[i+1:], c)
+			if end == -1 {
+				return nil, false
+			}
+			tokens = append(tokens, content[i:i+end+2])
+			i += end + 2
+		case strings.IndexByte("{}()<>[],;:=", c) != -1:
+			tokens = append(tokens, content[i:i+1])
+			i++
+		default:
+			start := i
+			for i < len(content) && strings.IndexByte(" \t\r\n{}()<>[],;:=\"'#/", content[i]) == -1 {
+				i++
+			}
+			if i == start {
+				return nil, false
+			}
+			tokens = append(tokens, content[start:i])
+		}
+	}
+	return tokens, true
+}
+
+func (parser *thriftParser) eof() bool {
+	return parser.pos >= len(parser.tokens)
+}
+
+func (parser *thriftParser) peek() string {
+	if parser.eof() {
+		return ""
+	}
+	return parser.tokens[parser.pos]
+}
+
+func (parser *thriftParser) next() string {
+	if parser.eof() {
+		panic("unexpected end")
+	}
+	parser.pos++
+	return parser.tokens[parser.pos-1]
+}
+
+func (parser *thriftParser) expect(token string) {
+	if parser.next() != token {
+		panic(token)
+	}
+}
+
+// skipSeparator . 跳过可选的 , ;
+func (parser *thriftParser) skipSeparator() {
+	if token := parser.peek(); token == "," || token == ";" {
+		parser.pos++
+	}
+}
+
+// skipAnnotations . 跳过 (key = "value") 形式的注解
+func (parser *thriftParser) skipAnnotations() {
+	if parser.peek() == "(" {
+		parser.skipValue()
+	}
+}
+
+// skipValue . 跳过常量值或成对的括号
+func (parser *thriftParser) skipValue() {
+	depth := 0
+	for {
+		switch parser.next() {
+		case "{", "[", "(":
+			depth++
+		case "}", "]", ")":
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (parser *thriftParser) parseType() *thriftType {
+	typ := &thriftType{name: parser.next()}
+	switch typ.name {
+	case "list", "set":
+		parser.expect("<")
+		typ.elem = parser.parseType()
+		parser.expect(">")
+	case "map":
+		parser.expect("<")
+		typ.key = parser.parseType()
+		parser.expect(",")
+		typ.elem = parser.parseType()
+		parser.expect(">")
+	}
+	parser.skipAnnotations()
+	return typ
+}
+
+func (parser *thriftParser) parseEnum() map[string]int64 {
+	values := make(map[string]int64)
+	parser.expect("{")
+	var value int64
+	for parser.peek() != "}" {
+		name := parser.next()
+		if parser.peek() == "=" {
+			parser.next()
+			v, err := strconv.ParseInt(parser.next(), 0, 64)
+			if err != nil {
+				panic(err)
+			}
+			value = v
+		}
+		values[name] = value
+		value++
+		parser.skipAnnotations()
+		parser.skipSeparator()
+	}
+	parser.next()
+	return values
+}
+
+// parseFields . 解析字段直到 end, 没有 id 的字段按 -1 -2 ... 编号
+func (parser *thriftParser) parseFields(end string) []*thriftField {
+	fields := make([]*thriftField, 0)
+	var implicit int16
+	for parser.peek() != end {
+		field := &thriftField{}
+		if next := parser.tokens[parser.pos+1]; next == ":" {
+			id, err := strconv.ParseInt(parser.next(), 0, 16)
+			if err != nil {
+				panic(err)
+			}
+			field.id = int16(id)
+			parser.next()
+		} else {
+			implicit--
+			field.id = implicit
+		}
+		switch parser.peek() {
+		case "required":
+			field.required = true
+			parser.next()
+		case "optional":
+			parser.next()
+		}
+		field.typ = parser.parseType()
+		field.name = parser.next()
+		if parser.peek() == "=" {
+			parser.next()
+			parser.skipValue()
+		}
+		parser.skipAnnotations()
+		parser.skipSeparator()
+		fields = append(fields, field)
+	}
+	parser.next()
+	return fields
+}
+
+func (parser *thriftParser) parseService() *thriftService {
+	service := &thriftService{name: parser.next(), methods: make(map[string]*thriftMethod)}
+	if parser.peek() == "extends" {
+		parser.next()
+		service.extends = parser.next()
+	}
+	parser.expect("{")
+	for parser.peek() != "}" {
+		method := &thriftMethod{service: service.name}
+		if parser.peek() == "oneway" {
+			method.oneway = true
+			parser.next()
+		}
+		if parser.peek() == "void" {
+			method.void = true
+			parser.next()
+		} else {
+			method.result = parser.parseType()
+		}
+		method.name = parser.next()
+		parser.expect("(")
+		method.args = parser.parseFields(")")
+		if parser.peek() == "throws" {
+			parser.next()
+			parser.expect("(")
+			method.throws = parser.parseFields(")")
+		}
+		parser.skipAnnotations()
+		parser.skipSeparator()
+		service.methods[method.name] = method
+	}
+	parser.next()
+	return service
+}
@@ -0,0 +1,303 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+const userIDL = `
+namespace go user
+include "base.thrift"
+
+typedef i64 UserID
+
+/* 性别 */
+enum Gender { MALE = 1, FEMALE = 2 }
+
+struct User {
+	1: required UserID id,
+	2: string name,
+	3: Gender gender,
+	4: list<string> tags,
+	5: map<string, i32> scores (go.tag = "scores")
+}
+
+exception NotFound {
+	1: string message
+}
+
+service Base {
+	string ping()
+}
+
+# 用户服务
+service UserService extends Base {
+	User get(1: UserID id, 2: bool detail, 3: list<string> tags) throws (1: NotFound notFound),
+	oneway void log(1: string msg);
+	void touch(1: UserID id)
+}
+`
+
+func TestThriftIDL(t *testing.T) {
+	doc, err := parseThriftIDL(userIDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := thriftScope{doc}
+	if id, err := scope.typeID(&thriftType{name: "UserID"}); err != nil || id != thriftI64 {
+		t.Fatalf("typedef should resolve to i64, got %d %v", id, err)
+	}
+	if id, _ := scope.typeID(&thriftType{name: "Gender"}); id != thriftI32 {
+		t.Fatalf("enum should be i32, got %d", id)
+	}
+	user := doc.structs["User"]
+	if len(user.fields) != 5 || !user.fields[0].required || user.fields[4].typ.key.name != "string" {
+		t.Fatalf("unexpected struct %+v", user.fields)
+	}
+	group := &ThriftIDLGroup{}
+	if err := group.Add("user", userIDL); err != nil {
+		t.Fatal(err)
+	}
+	if method, _, err := group.method("UserService.ping"); err != nil || method.service != "Base" {
+		t.Fatalf("extends should be resolved, got %v %v", method, err)
+	}
+	if method, _, err := group.method("UserService.get"); err != nil || len(method.throws) != 1 {
+		t.Fatalf("unexpected method %v %v", method, err)
+	}
+	if _, _, err := group.method("UserService.missing"); err != ThriftMethodNotFound {
+		t.Fatalf("want ThriftMethodNotFound, got %v", err)
+	}
+	for _, content := range []string{"struct User {", "service {}", "/* comment", "enum E { A = x }"} {
+		if _, err := parseThriftIDL(content); err != ThriftIDLNotValid {
+			t.Fatalf("%q should not be valid", content)
+		}
+	}
+}
+
+// thriftServer . 测试用的 thrift 服务 按 framed 决定是否使用 TFramedTransport
+func thriftServer(t *testing.T, framed bool, accepted *int32) net.Listener {
+	doc, err := parseThriftIDL(userIDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := thriftScope{doc}
+	service := doc.services["UserService"]
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			r := &thriftReader{r: reader}
+			if framed {
+				if _, err := r.readI32(); err != nil {
+					return
+				}
+			}
+			name, _, seqID, err := r.readMessageBegin()
+			if err != nil {
+				return
+			}
+			method, ok := service.methods[name]
+			if !ok {
+				method = doc.services["Base"].methods[name]
+			}
+			args, err := scope.readStruct(r, method.args)
+			if err != nil {
+				return
+			}
+			typ, fields := byte(thriftReplyMessage), []*thriftField{{id: 0, name: "success", typ: method.result}}
+			fields = append(fields, method.throws...)
+			result := map[string]interface{}{}
+			switch {
+			case name == "ping":
+				result["success"] = "pong"
+			case name == "get" && args["id"] == int64(404):
+				result["notFound"] = map[string]interface{}{"message": "user 404"}
+			case name == "get" && args["id"] == int64(500):
+				typ, fields = thriftExceptionMessage, thriftApplicationException
+				result = map[string]interface{}{"message": "internal error", "type": int32(6)}
+			case name == "get":
+				if args["detail"] != true {
+					return
+				}
+				result["success"] = map[string]interface{}{
+					"id":     args["id"],
+					"name":   "user",
+					"gender": "FEMALE",
+					"tags":   args["tags"],
+					"scores": map[string]interface{}{"a": int32(1)},
+				}
+			}
+			if method.void {
+				fields = nil
+			}
+			var w thriftWriter
+			w.writeI32(int32(uint32(thriftVersion1) | uint32(typ)))
+			w.writeString(name)
+			w.writeI32(seqID)
+			if err := scope.writeStruct(&w, fields, result); err != nil {
+				t.Error(err)
+				return
+			}
+			message := w.Bytes()
+			if framed {
+				size := make([]byte, 4)
+				binary.BigEndian.PutUint32(size, uint32(len(message)))
+				message = append(size, message...)
+			}
+			if _, err := conn.Write(message); err != nil {
+				return
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			go serve(conn)
+		}
+	}()
+	return listener
+}
+
+func TestThrift(t *testing.T) {
+	for _, framed := range []bool{false, true} {
+		var accepted int32
+		listener := thriftServer(t, framed, &accepted)
+		engine := New()
+		if err := engine.AddThriftIDL("user", "struct User {"); err != ThriftIDLNotValid {
+			t.Fatalf("want ThriftIDLNotValid, got %v", err)
+		}
+		if err := engine.AddThriftIDL("user", userIDL); err != nil {
+			t.Fatal(err)
+		}
+		if idls := engine.ThriftIDLs(); len(idls) != 1 || len(idls[0].Services) != 2 {
+			t.Fatalf("unexpected idls %v", idls)
+		}
+		engine.AddCluster(&Cluster{Name: "user"})
+		_, cluster := engine.Cluster("user")
+		cluster.Add(&Backend{Addr: listener.Addr().String(), Schema: "thrift", HeartDisabled: true, Timeout: 5, Transport: TransportSetting{ThriftFramed: framed}})
+		engine.Route(RouteInfo{Method: "GET", URL: "/users/:id", NodeGroup: []Node{
+			{Cluster: "user", ThriftMethod: "UserService.get", ParamGroup: []Param{
+				{Attr: "id", From: ParamFromPath, To: ParamFromQuery, ToName: "id"},
+				{Attr: "detail", From: ParamFromQuery, To: ParamFromQuery, ToName: "detail"},
+				{Attr: "tag", From: ParamFromQuery, To: ParamFromQuery, ToName: "tags"},
+			}},
+		}})
+		engine.Route(RouteInfo{Method: "GET", URL: "/ping", NodeGroup: []Node{{Cluster: "user", ThriftMethod: "UserService.ping"}}})
+		engine.Route(RouteInfo{Method: "GET", URL: "/log", NodeGroup: []Node{{Cluster: "user", ThriftMethod: "UserService.log"}}})
+		serve := func(url string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+			return w
+		}
+
+		w := serve("/users/7?detail=true&tag=a")
+		var user struct {
+			ID     int64            `json:"id"`
+			Name   string           `json:"name"`
+			Gender string           `json:"gender"`
+			Tags   []string         `json:"tags"`
+			Scores map[string]int32 `json:"scores"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+		}
+		if user.ID != 7 || user.Name != "user" || user.Gender != "FEMALE" || strings.Join(user.Tags, ",") != "a" || user.Scores["a"] != 1 {
+			t.Fatalf("unexpected user %s", w.Body.String())
+		}
+		if w := serve("/ping"); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `"pong"` {
+			t.Fatalf("inherited method should be called, got %d %s", w.Code, w.Body.String())
+		}
+		// 声明的异常
+		if w := serve("/users/404"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"message":"user 404"`) {
+			t.Fatalf("unexpected exception response %d %s", w.Code, w.Body.String())
+		}
+		// TApplicationException
+		if w := serve("/users/500"); w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"code":6`) {
+			t.Fatalf("unexpected application exception %d %s", w.Code, w.Body.String())
+		}
+		if n := atomic.LoadInt32(&accepted); n != 1 {
+			t.Fatalf("connections should be reused, accepted %d", n)
+		}
+		if w := serve("/users/abc"); !strings.Contains(w.Body.String(), `"code":-9049`) {
+			t.Fatalf("want ThriftMessageNotValid, got %s", w.Body.String())
+		}
+		if w := serve("/log"); !strings.Contains(w.Body.String(), `"code":-9048`) {
+			t.Fatalf("oneway method should not be called, got %s", w.Body.String())
+		}
+		if err := engine.RemoveThriftIDL("user"); err != nil || engine.RemoveThriftIDL("user") != ThriftIDLNotFound {
+			t.Fatalf("unexpected remove result %v", err)
+		}
+		cluster.Remove(listener.Addr().String())
+		listener.Close()
+	}
+}
+
+// 非严格模式的消息头
+func TestThriftMessageBegin(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, int32(3))
+	buf.WriteString("get")
+	buf.WriteByte(thriftReplyMessage)
+	binary.Write(&buf, binary.BigEndian, int32(9))
+	r := &thriftReader{r: io.Reader(&buf)}
+	name, typ, seqID, err := r.readMessageBegin()
+	if err != nil || name != "get" || typ != thriftReplyMessage || seqID != 9 {
+		t.Fatalf("unexpected message %s %d %d %v", name, typ, seqID, err)
+	}
+}
+
+// 请求完成后立即取消, 放回连接池的连接不能带有过期的 deadline
+func TestThriftPoolCancel(t *testing.T) {
+	var accepted int32
+	listener := thriftServer(t, false, &accepted)
+	defer listener.Close()
+	group := &ThriftIDLGroup{}
+	group.Add("user", userIDL)
+	method, scope, err := group.method("UserService.ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := &thriftCall{method: method, scope: scope, args: []byte{thriftStop}}
+	pool := newThriftPool(listener.Addr().String(), TransportSetting{}.getDefaultSetting())
+	defer pool.close()
+	for i := 0; i < 200; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		status, body, err := call.do(ctx, pool)
+		cancel()
+		if err != nil || status != http.StatusOK || string(body) != `"pong"` {
+			t.Fatalf("request %d failed: %d %s %v", i, status, body, err)
+		}
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Fatalf("connections should be reused, accepted %d", n)
+	}
+}
+
+// 字符串返回值编码为 JSON, 不会被当作其他类型解析
+func TestThriftStringResult(t *testing.T) {
+	for _, str := range []string{"123", "true", `{"a":1}`, "pong"} {
+		body, _ := json.Marshal(str)
+		if val := (combineResponse{Response: body, encoded: true}).value(); val != str {
+			t.Fatalf("string result %q rendered as %#v", str, val)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// TLSSetting . https 后端服务的 TLS 配置 证书与私钥为 PEM 格式的内容
+type TLSSetting struct {
+	// CA 证书 为空时使用系统的根证书
+	CA string `json:"ca"`
+	// 客户端证书与私钥 用于双向认证
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// 校验证书与 SNI 使用的域名 为空时使用 Addr 中的主机名
+	ServerName string `json:"serverName"`
+	// 最低版本 1.0|1.1|1.2|1.3
+	MinVersion string `json:"minVersion"`
+	// 跳过证书校验 仅用于测试环境
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config . 生成 tls.Config, 未做任何配置时返回 nil 使用默认配置
+func (setting TLSSetting) Config() (*tls.Config, error) {
+	if setting == (TLSSetting{}) {
+		return nil, nil
+	}
+	config := &tls.Config{
+		ServerName:         setting.ServerName,
+		InsecureSkipVerify: setting.InsecureSkipVerify,
+	}
+	if setting.MinVersion != "" {
+		version, ok := tlsVersions[setting.MinVersion]
+		if !ok {
+			return nil, TLSConfigNotValid
+		}
+		config.MinVersion = version
+	}
+	if setting.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(setting.CA)) {
+			return nil, TLSConfigNotValid
+		}
+		config.RootCAs = pool
+	}
+	if setting.Cert != "" || setting.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(setting.Cert), []byte(setting.Key))
+		if err != nil {
+			return nil, TLSConfigNotValid
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
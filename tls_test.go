@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 生成自签名的客户端证书
+func newClientCert(t *testing.T) (certPEM, keyPEM []byte, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gateway"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), cert
+}
+
+func TestTLSSetting(t *testing.T) {
+	if config, err := (TLSSetting{}).Config(); config != nil || err != nil {
+		t.Fatal("empty setting should use default config")
+	}
+	for _, setting := range []TLSSetting{
+		{CA: "invalid"},
+		{MinVersion: "2.0"},
+		{Cert: "invalid", Key: "invalid"},
+	} {
+		if _, err := setting.Config(); err != TLSConfigNotValid {
+			t.Fatalf("setting %+v expect %v got %v", setting, TLSConfigNotValid, err)
+		}
+	}
+	if err := (&Cluster{Name: "tls"}).Add(&Backend{Addr: "127.0.0.1:1", TLS: TLSSetting{CA: "invalid"}}); err != TLSConfigNotValid {
+		t.Fatalf("expect %v got %v", TLSConfigNotValid, err)
+	}
+}
+
+func TestBackend_TLS(t *testing.T) {
+	clientCert, clientKey, cert := newClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cn":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	engine := New()
+	engine.AddCluster(&Cluster{Name: "tls"})
+	_, cluster := engine.Cluster("tls")
+	addr := strings.TrimPrefix(server.URL, "https://")
+	for _, backend := range []*Backend{
+		{Addr: addr, TLS: TLSSetting{CA: string(ca), ServerName: "example.com", MinVersion: "1.2", Cert: string(clientCert), Key: string(clientKey)}},
+		{Addr: "localhost" + addr[strings.LastIndexByte(addr, ':'):], TLS: TLSSetting{CA: string(ca)}},
+	} {
+		backend.Schema, backend.HeartDisabled, backend.Timeout = "https", true, 5
+		if err := cluster.Add(backend); err != nil {
+			t.Fatal(err)
+		}
+	}
+	node := Node{Cluster: "tls", Rewrite: "/"}
+	ctx := engine.allocateContext()
+	ctx.reset()
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	ctx.routeInfo = RouteInfo{Method: "GET"}
+	results := make(map[string]combineResponse)
+	for _, backend := range cluster.Backends() {
+		res := combineResponse{}
+		node.call(ctx, cluster, backend, ParseParam{}, 1, &res)
+		results[backend.Addr] = res
+	}
+	if res := results[addr]; res.Error != nil || string(res.Response) != `{"cn":"gateway"}` {
+		t.Fatalf("mutual tls request failed %v %s", res.Error, res.Response)
+	}
+	// 没有客户端证书
+	if res := results["localhost"+addr[strings.LastIndexByte(addr, ':'):]]; res.Error == nil {
+		t.Fatal("request without client certificate should fail")
+	}
+}
+
+// 管理接口不返回私钥
+func TestBackend_MarshalJSONTLS(t *testing.T) {
+	backend := &Backend{Addr: "127.0.0.1:1", TLS: TLSSetting{Cert: "cert", Key: "secret", ServerName: "example.com"}}
+	data, err := json.Marshal(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		TLS struct {
+			Cert       string `json:"cert"`
+			Key        string `json:"key"`
+			HasKey     bool   `json:"hasKey"`
+			ServerName string `json:"serverName"`
+		} `json:"tls"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || strings.Contains(string(data), "secret") {
+		t.Fatalf("private key should be redacted, got %s", data)
+	}
+	if !out.TLS.HasKey || out.TLS.Key != "" || out.TLS.Cert != "cert" || out.TLS.ServerName != "example.com" {
+		t.Fatalf("unexpected tls %+v", out.TLS)
+	}
+	if backend.TLS.Key != "secret" {
+		t.Fatal("marshal should not modify the backend")
+	}
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// gRPC 状态码对应的 HTTP 状态码
+var grpcHTTPStatus = map[int]int{
+	0:  http.StatusOK,
+	1:  499,
+	2:  http.StatusInternalServerError,
+	3:  http.StatusBadRequest,
+	4:  http.StatusGatewayTimeout,
+	5:  http.StatusNotFound,
+	6:  http.StatusConflict,
+	7:  http.StatusForbidden,
+	8:  http.StatusTooManyRequests,
+	9:  http.StatusBadRequest,
+	10: http.StatusConflict,
+	11: http.StatusBadRequest,
+	12: http.StatusNotImplemented,
+	13: http.StatusInternalServerError,
+	14: http.StatusServiceUnavailable,
+	15: http.StatusInternalServerError,
+	16: http.StatusUnauthorized,
+}
+
+// grpcCall . 转码后的 gRPC 请求
+type grpcCall struct {
+	method  protoreflect.MethodDescriptor
+	payload []byte
+}
+
+// path . gRPC 请求路径 /package.Service/Method
+func (call *grpcCall) path() string {
+	return "/" + string(call.method.Parent().FullName()) + "/" + string(call.method.Name())
+}
+
+// grpcRequest . 参数按 ToName 转为 protobuf 请求消息 只支持 unary 方法
+func (node Node) grpcRequest(ctx *Context, parseParam ParseParam) (*grpcCall, error) {
+	method, err := ctx.engine.descriptors.method(node.GRPCMethod)
+	if err != nil {
+		return nil, err
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, GRPCMethodNotFound
+	}
+	fields := parseParam.message()
+	protoJSONObject(method.Input(), fields)
+	b, _ := json.Marshal(fields)
+	message := dynamicpb.NewMessage(method.Input())
+	if err = (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, message); err != nil {
+		return nil, GRPCMessageNotValid
+	}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return nil, GRPCMessageNotValid
+	}
+	return &grpcCall{method: method, payload: payload}, nil
+}
+
+// message . Query Body JSON 参数合并为请求消息的字段 JSON 参数优先
+func (parseParam ParseParam) message() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, values := range []url.Values{parseParam.query, parseParam.body} {
+		for key, vals := range values {
+			if len(vals) == 1 {
+				setJSONPath(fields, key, vals[0])
+				continue
+			}
+			list := make([]interface{}, len(vals))
+			for i, val := range vals {
+				list[i] = val
+			}
+			setJSONPath(fields, key, list)
+		}
+	}
+	for key, val := range parseParam.json {
+		fields[key] = val
+	}
+	return fields
+}
+
+// protoJSONObject . 按消息定义转换参数 字符串转为 bool, 单个值转为 repeated
+// 数字可以是字符串, protojson 可以直接解析 未传的非字符串字段使用默认值
+func protoJSONObject(desc protoreflect.MessageDescriptor, obj map[string]interface{}) {
+	fields := desc.Fields()
+	for key, val := range obj {
+		field := fields.ByJSONName(key)
+		if field == nil {
+			field = fields.ByName(protoreflect.Name(key))
+		}
+		if field == nil {
+			continue
+		}
+		if str, ok := val.(string); ok && str == "" && field.Kind() != protoreflect.StringKind && field.Kind() != protoreflect.BytesKind {
+			delete(obj, key)
+			continue
+		}
+		obj[key] = protoJSONValue(field, val)
+	}
+}
+
+func protoJSONValue(field protoreflect.FieldDescriptor, val interface{}) interface{} {
+	switch {
+	case field.IsList():
+		list, ok := val.([]interface{})
+		if !ok {
+			list = []interface{}{val}
+		}
+		for i := range list {
+			list[i] = protoJSONScalar(field, list[i])
+		}
+		return list
+	case field.IsMap():
+		if obj, ok := val.(map[string]interface{}); ok {
+			for key := range obj {
+				obj[key] = protoJSONScalar(field.MapValue(), obj[key])
+			}
+		}
+		return val
+	}
+	return protoJSONScalar(field, val)
+}
+
+func protoJSONScalar(field protoreflect.FieldDescriptor, val interface{}) interface{} {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if obj, ok := val.(map[string]interface{}); ok {
+			protoJSONObject(field.Message(), obj)
+		}
+	case protoreflect.BoolKind:
+		if str, ok := val.(string); ok {
+			if b, err := strconv.ParseBool(str); err == nil {
+				return b
+			}
+		}
+	}
+	return val
+}
+
+// decode . gRPC 响应转为 JSON, gRPC 状态码转为 HTTP 状态码
+// 失败时返回 {"code": gRPC 状态码, "message": 错误信息}
+func (call *grpcCall) decode(res *http.Response, body []byte) (int, []byte, error) {
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, body, nil
+	}
+	// trailers-only 响应的状态在响应头中
+	trailer := res.Trailer
+	if trailer.Get("Grpc-Status") == "" {
+		trailer = res.Header
+	}
+	code, err := strconv.Atoi(trailer.Get("Grpc-Status"))
+	if err != nil {
+		return res.StatusCode, nil, fmt.Errorf("grpc-status missing")
+	}
+	if code != 0 {
+		message, _ := url.PathUnescape(trailer.Get("Grpc-Message"))
+		status, ok := grpcHTTPStatus[code]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		b, _ := json.Marshal(H{"code": code, "message": message})
+		return status, b, nil
+	}
+	if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return res.StatusCode, nil, fmt.Errorf("grpc message frame not valid")
+	}
+	message := dynamicpb.NewMessage(call.method.Output())
+	if err = proto.Unmarshal(body[5:], message); err != nil {
+		return res.StatusCode, nil, err
+	}
+	b, err := (protojson.MarshalOptions{EmitUnpopulated: true}).Marshal(message)
+	return http.StatusOK, b, err
+}
@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// echo.proto
+//
+//	message SayRequest { string name = 1; int32 count = 2; bool loud = 3; repeated string tags = 4; }
+//	message SayReply { string message = 1; int32 count = 2; repeated string tags = 3; }
+//	service Echo { rpc Say(SayRequest) returns (SayReply); }
+func echoDescriptor() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     kind.Enum(),
+			Label:    label.Enum(),
+		}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("echo.proto"),
+		Package: proto.String("echo"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("SayRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, false),
+				field("loud", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, false),
+				field("tags", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+			}},
+			{Name: proto.String("SayReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, false),
+				field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{Name: proto.String("Echo"), Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Say"), InputType: proto.String(".echo.SayRequest"), OutputType: proto.String(".echo.SayReply")},
+			}},
+		},
+	}
+}
+
+func TestGRPCTranscode(t *testing.T) {
+	fileProto := echoDescriptor()
+	file, err := protodesc.NewFile(fileProto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, reply := file.Messages().ByName("SayRequest"), file.Messages().ByName("SayReply")
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/echo.Echo/Say" || r.Header.Get("Content-Type") != "application/grpc" || len(body) < 5 ||
+			int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		in := dynamicpb.NewMessage(request)
+		if err := proto.Unmarshal(body[5:], in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		name := in.Get(request.Fields().ByName("name")).String()
+		if name == "missing" {
+			// trailers-only
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "user%20not%20found")
+			return
+		}
+		if in.Get(request.Fields().ByName("loud")).Bool() {
+			name = strings.ToUpper(name)
+		}
+		out := dynamicpb.NewMessage(reply)
+		out.Set(reply.Fields().ByName("message"), protoreflect.ValueOfString("hello "+name))
+		out.Set(reply.Fields().ByName("count"), in.Get(request.Fields().ByName("count")))
+		tags := out.Mutable(reply.Fields().ByName("tags")).List()
+		inTags := in.Get(request.Fields().ByName("tags")).List()
+		for i := 0; i < inTags.Len(); i++ {
+			tags.Append(inTags.Get(i))
+		}
+		b, _ := proto.Marshal(out)
+		w.Write(grpcFrame(0, b))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	engine := New()
+	data, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fileProto}})
+	if err := engine.AddDescriptorSet("echo", []byte("bad")); err != DescriptorSetNotValid {
+		t.Fatalf("want DescriptorSetNotValid, got %v", err)
+	}
+	if err := engine.AddDescriptorSet("echo", data); err != nil {
+		t.Fatal(err)
+	}
+	if sets := engine.DescriptorSets(); len(sets) != 1 || sets[0].Services[0] != "echo.Echo" {
+		t.Fatalf("unexpected descriptor sets %v", sets)
+	}
+	engine.AddCluster(&Cluster{Name: "echo"})
+	_, cluster := engine.Cluster("echo")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5, Transport: TransportSetting{HTTP2: true}})
+	engine.Route(RouteInfo{Method: "GET", URL: "/hello/:name", NodeGroup: []Node{
+		{Cluster: "echo", GRPCMethod: "echo.Echo/Say", ParamGroup: []Param{
+			{Attr: "name", From: ParamFromPath, To: ParamFromQuery, ToName: "name"},
+			{Attr: "count", From: ParamFromQuery, To: ParamFromQuery, ToName: "count"},
+			{Attr: "loud", From: ParamFromQuery, To: ParamFromQuery, ToName: "loud"},
+			{Attr: "tag", From: ParamFromQuery, To: ParamFromQuery, ToName: "tags"},
+		}},
+	}})
+	engine.Route(RouteInfo{Method: "GET", URL: "/missing", NodeGroup: []Node{
+		{Cluster: "echo", GRPCMethod: "echo.Echo/Missing"},
+	}})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/hello/gopher?count=3&loud=true&tag=a", nil))
+	var result struct {
+		Message string   `json:"message"`
+		Count   int      `json:"count"`
+		Tags    []string `json:"tags"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if result.Message != "hello GOPHER" || result.Count != 3 || len(result.Tags) != 1 || result.Tags[0] != "a" {
+		t.Fatalf("unexpected reply %s", w.Body.String())
+	}
+
+	// gRPC 状态码转为 HTTP 状态码
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/hello/missing", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"message":"user not found"`) {
+		t.Fatalf("unexpected error response %d %s", w.Code, w.Body.String())
+	}
+	// 参数无法转换为消息
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/hello/gopher?count=abc", nil))
+	if !strings.Contains(w.Body.String(), `"code":-9045`) {
+		t.Fatalf("want GRPCMessageNotValid, got %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if !strings.Contains(w.Body.String(), `"code":-9044`) {
+		t.Fatalf("want GRPCMethodNotFound, got %s", w.Body.String())
+	}
+	if err := engine.RemoveDescriptorSet("echo"); err != nil || engine.RemoveDescriptorSet("echo") != DescriptorSetNotFound {
+		t.Fatalf("unexpected remove result %v", err)
+	}
+}
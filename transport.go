@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost . 默认每个后端服务保持的空闲连接数
+	DefaultMaxIdleConnsPerHost = 64
+	// DefaultIdleConnTimeoutInSeconds . 默认空闲连接超时时间
+	DefaultIdleConnTimeoutInSeconds = 90
+	// DefaultDialTimeoutInMilliseconds . 默认建立连接超时时间
+	DefaultDialTimeoutInMilliseconds = 3000
+	// DefaultTLSHandshakeTimeoutInMilliseconds . 默认 TLS 握手超时时间
+	DefaultTLSHandshakeTimeoutInMilliseconds = 3000
+)
+
+// TransportSetting . 后端服务的连接配置 每个后端服务使用独立的连接池
+type TransportSetting struct {
+	// 每个后端服务保持的空闲连接数
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost"`
+	// 空闲连接超时时间(秒)
+	IdleConnTimeout int64 `json:"idleConnTimeout"`
+	// 建立连接超时时间(毫秒)
+	DialTimeout int64 `json:"dialTimeout"`
+	// TLS 握手超时时间(毫秒)
+	TLSHandshakeTimeout int64 `json:"tlsHandshakeTimeout"`
+	// 是否使用 HTTP/2 https 通过 ALPN 协商, http 直接使用 h2c (gRPC 后端服务需要开启)
+	HTTP2 bool `json:"http2"`
+	// thrift 后端服务是否使用 TFramedTransport
+	ThriftFramed bool `json:"thriftFramed"`
+}
+
+// 设置默认值
+func (setting TransportSetting) getDefaultSetting() TransportSetting {
+	if setting.MaxIdleConnsPerHost < 1 {
+		setting.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if setting.IdleConnTimeout < 1 {
+		setting.IdleConnTimeout = DefaultIdleConnTimeoutInSeconds
+	}
+	if setting.DialTimeout < 1 {
+		setting.DialTimeout = DefaultDialTimeoutInMilliseconds
+	}
+	if setting.TLSHandshakeTimeout < 1 {
+		setting.TLSHandshakeTimeout = DefaultTLSHandshakeTimeoutInMilliseconds
+	}
+	return setting
+}
+
+// transport . 按配置创建连接池, 请求的超时时间由 context 控制
+func (setting TransportSetting) transport(schema string, tlsConfig *tls.Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(setting.DialTimeout) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+	if setting.HTTP2 && schema != "https" {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			IdleConnTimeout: time.Duration(setting.IdleConnTimeout) * time.Second,
+		}
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConnsPerHost:   setting.MaxIdleConnsPerHost,
+		IdleConnTimeout:       time.Duration(setting.IdleConnTimeout) * time.Second,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   time.Duration(setting.TLSHandshakeTimeout) * time.Millisecond,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     setting.HTTP2,
+	}
+}
+
+// client . 后端服务的 http.Client
+func (backend *Backend) client() *http.Client {
+	if backend.httpClient == nil {
+		return http.DefaultClient
+	}
+	return backend.httpClient
+}
+
+// close . 后端服务被移除或替换时停止健康检查并关闭空闲连接
+func (backend *Backend) close() {
+	if backend.stop != nil {
+		close(backend.stop)
+		backend.stop = nil
+	}
+	if transport, ok := backend.transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+	if backend.thrift != nil {
+		backend.thrift.close()
+	}
+}
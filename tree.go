@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"strings"
+)
+
+type (
+	// PathParam . 路径参数
+	PathParam struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	// PathParams .
+	PathParams []PathParam
+
+	// routeNode . 路由树节点
+	// 静态段优先匹配, 其次是 :name 命名段, 最后是 *name 通配段
+	routeNode struct {
+		segment  string
+		children map[string]*routeNode
+		param    *routeNode
+		catchAll *routeNode
+		route    *RouteInfo
+	}
+)
+
+// Get . 获取路径参数
+func (params PathParams) Get(key string) (string, bool) {
+	for i, l := 0, len(params); i < l; i++ {
+		if params[i].Key == key {
+			return params[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName . 获取路径参数, 不存在时返回空字符串
+func (params PathParams) ByName(key string) string {
+	val, _ := params.Get(key)
+	return val
+}
+
+func newRouteNode(segment string) *routeNode {
+	return &routeNode{
+		segment:  segment,
+		children: make(map[string]*routeNode),
+	}
+}
+
+// 拆分路径 "/users/1/orders" => ["users", "1", "orders"]
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// insert . 插入路由
+func (n *routeNode) insert(routeInfo RouteInfo) error {
+	segments := splitPath(routeInfo.URL)
+	for i, l := 0, len(segments); i < l; i++ {
+		segment := segments[i]
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if name == "" {
+				return URLNotValid
+			}
+			if n.param == nil {
+				n.param = newRouteNode(name)
+			} else if n.param.segment != name {
+				return RouteConflict
+			}
+			n = n.param
+		case strings.HasPrefix(segment, "*"):
+			name := segment[1:]
+			if name == "" || i != l-1 {
+				return URLNotValid
+			}
+			if n.catchAll == nil {
+				n.catchAll = newRouteNode(name)
+			} else if n.catchAll.segment != name {
+				return RouteConflict
+			}
+			n = n.catchAll
+		default:
+			child, ok := n.children[segment]
+			if !ok {
+				child = newRouteNode(segment)
+				n.children[segment] = child
+			}
+			n = child
+		}
+	}
+	if n.route != nil {
+		return APIAlreadyExist
+	}
+	n.route = &routeInfo
+	return nil
+}
+
+// lookup . 匹配路由, 失败时回溯尝试优先级更低的分支
+func (n *routeNode) lookup(segments []string, params PathParams) (*RouteInfo, PathParams) {
+	if len(segments) == 0 {
+		if n.route != nil {
+			return n.route, params
+		}
+		if n.catchAll != nil && n.catchAll.route != nil {
+			return n.catchAll.route, append(params, PathParam{n.catchAll.segment, ""})
+		}
+		return nil, params
+	}
+	if child, ok := n.children[segments[0]]; ok {
+		if route, matched := child.lookup(segments[1:], params); route != nil {
+			return route, matched
+		}
+	}
+	if n.param != nil && segments[0] != "" {
+		if route, matched := n.param.lookup(segments[1:], append(params, PathParam{n.param.segment, segments[0]})); route != nil {
+			return route, matched
+		}
+	}
+	if n.catchAll != nil && n.catchAll.route != nil {
+		return n.catchAll.route, append(params, PathParam{n.catchAll.segment, strings.Join(segments, "/")})
+	}
+	return nil, params
+}
@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultIdleTimeoutInMilliseconds . 默认 WebSocket 连接空闲超时时间
+	DefaultIdleTimeoutInMilliseconds = 60000
+
+	spliceBufferSize = 32 * 1024
+)
+
+// isWebSocket . 是否为 WebSocket 升级请求
+func isWebSocket(req *http.Request) bool {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, value := range req.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// idleTimeout . WebSocket 连接空闲超时时间
+func (routeInfo RouteInfo) idleTimeout() time.Duration {
+	if routeInfo.IdleTimeout > 0 {
+		return time.Duration(routeInfo.IdleTimeout) * time.Millisecond
+	}
+	return DefaultIdleTimeoutInMilliseconds * time.Millisecond
+}
+
+// dial . 与后端服务建立连接 https 使用后端服务的 TLS 配置
+func (backend *Backend) dial(ctx context.Context) (net.Conn, error) {
+	setting := backend.Transport.getDefaultSetting()
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(setting.DialTimeout) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", backend.Addr)
+	if err != nil || backend.Schema != "https" {
+		return conn, err
+	}
+	tlsConfig, err := backend.TLS.Config()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(backend.Addr)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	conn.SetDeadline(time.Now().Add(time.Duration(setting.TLSHandshakeTimeout) * time.Millisecond))
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// websocket . 转发 WebSocket 升级请求 握手成功后双向转发两个连接的数据
+// 路由的插件在握手时执行, 路由的超时时间只对握手生效, 之后由 IdleTimeout 控制
+func (node Node) websocket(ctx *Context) {
+	has, cluster := ctx.engine.clusters.Get(node.Cluster)
+	if !has {
+		ctx.Render(http.StatusBadGateway, ClusterNotFound)
+		return
+	}
+	backend, err := cluster.Balance(ctx)
+	if err != nil {
+		ctx.Render(http.StatusBadGateway, err)
+		return
+	}
+	path := ctx.Request.URL.EscapedPath()
+	if node.Rewrite != "" {
+		path = node.rewrite(ctx, nil)
+	}
+	if ctx.Request.URL.RawQuery != "" {
+		path += "?" + ctx.Request.URL.RawQuery
+	}
+	execInfo := ExecInfo{
+		BackendADDR: backend.Addr,
+		BackendURI:  backend.Schema + "://" + backend.Addr + path,
+		Attempt:     1,
+		Success:     true,
+	}
+	defer func() {
+		ctx.ExecInfoGroup = append(ctx.ExecInfoGroup, execInfo)
+	}()
+	now := time.Now()
+	fail := func(err error) {
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		if ctx.Err() != nil {
+			backend.abandon()
+			ctx.Render(http.StatusGatewayTimeout, ctx.abortError())
+			return
+		}
+		backend.observe(time.Since(now), true)
+		cluster.report(backend, 0, err)
+		if err = backendError(err); err == BackendTimeout {
+			ctx.Render(http.StatusGatewayTimeout, err)
+			return
+		}
+		ctx.Render(http.StatusBadGateway, err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx.base(), node.timeout(ctx, backend))
+	defer cancel()
+	conn, err := backend.dial(timeoutCtx)
+	if err != nil {
+		fail(err)
+		return
+	}
+	// 握手阶段的超时时间
+	if deadline, ok := timeoutCtx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	req, err := http.NewRequest(ctx.Request.Method, execInfo.BackendURI, nil)
+	if err != nil {
+		conn.Close()
+		fail(err)
+		return
+	}
+	copyHeader(req.Header, ctx.Request.Header)
+	removeHopHeaders(req.Header)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", ctx.Request.Header.Get("Upgrade"))
+	req.Host = ctx.Request.Host
+	req.Header.Set("Gate-Cluster", cluster.Name)
+	if clientIP := ctx.ClientIP(); clientIP != "" {
+		req.Header.Set("X-Forwarded-For", clientIP)
+	}
+	reader := bufio.NewReader(conn)
+	var res *http.Response
+	if err = req.Write(conn); err == nil {
+		res, err = http.ReadResponse(reader, req)
+	}
+	execInfo.ExecTime = float64(time.Since(now).Nanoseconds() / 1000000)
+	if err != nil {
+		conn.Close()
+		fail(err)
+		return
+	}
+	execInfo.Status = res.StatusCode
+	backend.observe(time.Since(now), res.StatusCode >= http.StatusInternalServerError)
+	cluster.report(backend, res.StatusCode, nil)
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		// 后端服务拒绝升级 原样返回
+		defer conn.Close()
+		defer res.Body.Close()
+		removeHopHeaders(res.Header)
+		copyHeader(ctx.Writer.Header(), res.Header)
+		ctx.Writer.WriteHeader(res.StatusCode)
+		ctx.Writer.WriteHeaderNow()
+		io.Copy(ctx.Writer, res.Body)
+		return
+	}
+	clientConn, clientBuf, err := ctx.Writer.Hijack()
+	if err != nil {
+		conn.Close()
+		execInfo.Success = false
+		execInfo.Error = err.Error()
+		ctx.Render(http.StatusInternalServerError, err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	// 握手响应需要保留 Upgrade 与 Connection
+	fmt.Fprintf(clientBuf, "HTTP/1.1 %s\r\n", res.Status)
+	res.Header.Write(clientBuf)
+	clientBuf.WriteString("\r\n")
+	if err = clientBuf.Flush(); err != nil {
+		clientConn.Close()
+		conn.Close()
+		return
+	}
+	atomic.AddInt64(&backend.Connections, 1)
+	defer atomic.AddInt64(&backend.Connections, -1)
+	splice(clientConn, clientBuf.Reader, conn, reader, ctx.routeInfo.idleTimeout())
+}
+
+// splice . 双向转发 任一方向结束或超过空闲时间后关闭两个连接
+func splice(client net.Conn, clientReader io.Reader, backend net.Conn, backendReader io.Reader, idle time.Duration) {
+	active := time.Now().UnixNano()
+	done := make(chan struct{}, 2)
+	transfer := func(dst net.Conn, src io.Reader) {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, spliceBufferSize)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				atomic.StoreInt64(&active, time.Now().UnixNano())
+				if _, err := dst.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	go transfer(backend, clientReader)
+	go transfer(client, backendReader)
+	ticker := time.NewTicker(idle / 4)
+	defer ticker.Stop()
+	pending := 2
+wait:
+	for {
+		select {
+		case <-done:
+			pending--
+			break wait
+		case now := <-ticker.C:
+			if now.Sub(time.Unix(0, atomic.LoadInt64(&active))) >= idle {
+				break wait
+			}
+		}
+	}
+	client.Close()
+	backend.Close()
+	for ; pending > 0; pending-- {
+		<-done
+	}
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 握手时校验 X-Token
+type tokenPlugin struct{}
+
+func (p tokenPlugin) Name() string    { return "token" }
+func (p tokenPlugin) Private() bool   { return false }
+func (p tokenPlugin) Version() string { return "0.1" }
+func (p tokenPlugin) Handle(ctx *Context) {
+	if ctx.Request.Header.Get("X-Token") != "ok" {
+		ctx.Render(http.StatusUnauthorized, TokenValidFailed)
+		ctx.Abort()
+	}
+}
+
+// 按行回显的 WebSocket 后端服务
+func newEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocket(r) || r.URL.Path != "/echo" || r.Header.Get("Gate-Cluster") != "realtime" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		for {
+			line, err := buf.ReadString('\n')
+			if err != nil {
+				return
+			}
+			buf.WriteString("echo " + line)
+			buf.Flush()
+		}
+	}))
+}
+
+func dialWebSocket(t *testing.T, addr, path, token string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nX-Token: %s\r\n\r\n", path, addr, token)
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, res
+}
+
+func TestWebSocket(t *testing.T) {
+	backend := newEchoServer(t)
+	defer backend.Close()
+	engine := New()
+	engine.RegisterPlugin(Proxy{})
+	engine.RegisterPlugin(tokenPlugin{})
+	engine.AddCluster(&Cluster{Name: "realtime"})
+	_, cluster := engine.Cluster("realtime")
+	cluster.Add(&Backend{Addr: strings.TrimPrefix(backend.URL, "http://"), Schema: "http", HeartDisabled: true, Timeout: 5})
+	engine.Route(RouteInfo{Method: "GET", URL: "/ws", Handlers: []string{"token"}, Timeout: 100, IdleTimeout: 300, NodeGroup: []Node{
+		{Cluster: "realtime", Rewrite: "/echo"},
+	}})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	conn, _, res := dialWebSocket(t, addr, "/ws", "bad")
+	conn.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("plugins should run on handshake, got %d", res.StatusCode)
+	}
+
+	conn, reader, res := dialWebSocket(t, addr, "/ws", "ok")
+	defer conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("unexpected handshake %d %v", res.StatusCode, res.Header)
+	}
+	// 超过路由的超时时间后连接仍然可用
+	time.Sleep(150 * time.Millisecond)
+	for _, msg := range []string{"hello", "world"} {
+		fmt.Fprintf(conn, "%s\n", msg)
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "echo "+msg+"\n" {
+			t.Fatalf("unexpected echo %q %v", line, err)
+		}
+	}
+	if connections := atomic.LoadInt64(&cluster.Backends()[0].Connections); connections != 1 {
+		t.Fatalf("want 1 connection, got %d", connections)
+	}
+	// 空闲超时后关闭连接
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := reader.ReadByte(); err == nil {
+		t.Fatal("idle connection should be closed")
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&cluster.Backends()[0].Connections) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection count should drop to 0")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}